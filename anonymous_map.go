@@ -0,0 +1,45 @@
+package mmap
+
+import (
+	"os"
+)
+
+// Anonymous creates a writeable map of size bytes that isn't backed by a file.
+// Its contents are lost when it is closed. If hugePageSize is not zero, the
+// memory comes from the kernel's hugetlb pool using huge pages of that size,
+// which must be configured on the system, and size is rounded up to a multiple
+// of it.
+func Anonymous(size int, hugePageSize int) (*Map, error) {
+	if size < 1 {
+		return nil, errors.New("size must be greater than zero").Set("size", size)
+	}
+
+	page := os.Getpagesize()
+	if hugePageSize != 0 {
+		if hugePageSize <= page || hugePageSize&(hugePageSize-1) != 0 {
+			return nil, errors.New("invalid huge page size").
+				Set("huge_page_size", hugePageSize)
+		}
+		page = hugePageSize
+		size = (size + page - 1) / page * page
+	}
+
+	m := &Map{
+		write:   true,
+		page:    page,
+		hugetlb: hugePageSize,
+		stats:   newStats(),
+		direct:  make(map[uintptr]Direct),
+		readers: make(map[int]*Reader),
+		writers: make(map[int]*Writer),
+	}
+
+	data, err := m.mmap(size)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not map anonymous memory").
+			Set("size", size).Set("huge_page_size", hugePageSize)
+	}
+	m.data = data
+
+	return m, nil
+}
@@ -0,0 +1,78 @@
+package mmap
+
+// Borrow returns a slice of n bytes of the map starting at offset without
+// copying, along with a function that releases it. Offset is relative to the
+// Reader's section, if any, and the Reader's offset is not changed.
+//
+// The slice points directly into the map and must not be modified. Until it is
+// released, the map holds a read lease that makes Truncate and Close fail
+// instead of unmapping the memory underneath it. A slice borrowed from a
+// SnapshotReader also keeps the snapshot mapped after the Reader is closed. The
+// release function may be called more than once.
+func (r *Reader) Borrow(offset int, n int) ([]byte, func(), error) {
+	r.access.RLock()
+	defer r.access.RUnlock()
+
+	r.lock()
+	defer r.Unlock()
+
+	data, err := r.view()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = r.checkRange(data, offset, n)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = r.checkProtect(r.base+offset, n, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r.lease()
+
+	released := false
+	release := func() {
+		r.lock()
+		defer r.Unlock()
+
+		if !released {
+			released = true
+			r.unlease()
+		}
+	}
+
+	end := offset + n
+
+	return data[offset:end:end], release, nil
+}
+
+// lease keeps the Reader's view mapped while it is used without the map
+// locked. Until the lease is released with unlease, the map can't be closed or
+// remapped, and neither can the Reader's snapshot. Lock the map before calling.
+func (r *Reader) lease() {
+	r.leases++
+	if r.snap != nil {
+		r.snap.leases++
+	}
+}
+
+// unlease releases a lease taken with lease. Lock the map before calling.
+func (r *Reader) unlease() {
+	r.leases--
+	if r.snap != nil {
+		r.releaseSnapshot(r.id, r.snap)
+	}
+}
+
+// checkLeases returns an error if any borrowed slices are still held.
+// Lock the map before calling.
+func (m *Map) checkLeases() error {
+	if m.leases > 0 {
+		return errors.New("mmap has borrowed slices that have not been released").
+			Set("name", m.Name()).Set("leases", m.leases)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package mmap
+
+import (
+	"os"
+	"testing"
+)
+
+func TestBorrowLease(t *testing.T) {
+	page := os.Getpagesize()
+	m, done := tempMap(t, page)
+	defer done()
+
+	w, err := m.Writer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("borrowed"))
+
+	b, release, err := w.Borrow(0, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "borrowed" {
+		t.Fatalf("borrowed %q", b)
+	}
+
+	if err := m.Truncate(int64(2 * page)); err == nil {
+		t.Fatal("Truncate succeeded with a borrowed slice")
+	}
+	if err := m.Close(); err == nil {
+		t.Fatal("Close succeeded with a borrowed slice")
+	}
+	if string(b) != "borrowed" {
+		t.Fatalf("borrowed slice changed to %q", b)
+	}
+
+	release()
+	release()
+
+	if err := m.Truncate(int64(2 * page)); err != nil {
+		t.Fatal(err)
+	}
+}
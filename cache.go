@@ -0,0 +1,231 @@
+package mmap
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Cache shares read-only maps of files between users, so a file that is read by
+// many goroutines is only mapped once. Maps are reference counted: each Get must
+// be paired with a Release, and the map must not be closed directly. When the
+// last user releases a map it is closed after the idle TTL, unless it is needed
+// again. If the file at a path is replaced or modified, the next Get opens the
+// new file, and the old map is closed once it has been released.
+type Cache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	opts    []Option
+	closed  bool
+	entries map[string]*cacheEntry
+	maps    map[*Map]*cacheEntry
+	opening map[string]chan struct{}
+}
+
+type cacheEntry struct {
+	path string
+	info os.FileInfo
+	m    *Map
+	refs int
+	gen  int
+}
+
+// NewCache creates a cache whose maps stay open for ttl after they were last
+// released. A ttl of zero closes maps as soon as they are released. The maps
+// are opened read-only with opts.
+func NewCache(ttl time.Duration, opts ...Option) *Cache {
+	return &Cache{
+		ttl:     ttl,
+		opts:    append(opts[:len(opts):len(opts)], WithReadOnly()),
+		entries: make(map[string]*cacheEntry),
+		maps:    make(map[*Map]*cacheEntry),
+		opening: make(map[string]chan struct{}),
+	}
+}
+
+// Get returns a shared read-only map of the file name. The same map is returned
+// for the same file until it is replaced or modified, which is detected by
+// comparing its device, inode, size and modification time. Release the map when
+// done with it. Concurrent calls for a file that isn't mapped yet wait for one of
+// them to open it, without holding up calls for other files.
+func (c *Cache) Get(name string) (*Map, error) {
+	path, err := filepath.Abs(name)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not resolve path").Set("name", name)
+	}
+
+	for {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not stat file").Set("name", name)
+		}
+
+		c.mu.Lock()
+
+		if c.closed {
+			c.mu.Unlock()
+			return nil, errors.New("cache closed").Set("name", name)
+		}
+
+		e := c.entries[path]
+		if e != nil && sameVersion(e.info, info) {
+			e.refs++
+			e.gen++
+			c.mu.Unlock()
+			return e.m, nil
+		}
+
+		// Wait for another Get that is opening the file and look again.
+		if o := c.opening[path]; o != nil {
+			c.mu.Unlock()
+			<-o
+			continue
+		}
+
+		o := make(chan struct{})
+		c.opening[path] = o
+		c.mu.Unlock()
+
+		m, opened, err := c.open(path)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		delete(c.opening, path)
+		close(o)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if c.closed {
+			m.Close()
+			return nil, errors.New("cache closed").Set("name", name)
+		}
+
+		if e := c.entries[path]; e != nil {
+			c.evict(e)
+		}
+
+		e = &cacheEntry{
+			path: path,
+			info: opened,
+			m:    m,
+			refs: 1,
+		}
+		c.entries[path] = e
+		c.maps[m] = e
+
+		return m, nil
+	}
+}
+
+// open maps the file at path without the cache locked, so other files can be
+// looked up meanwhile. It also returns information about the file that was
+// opened, which may be newer than the one that was looked up.
+func (c *Cache) open(path string) (*Map, os.FileInfo, error) {
+	m, err := OpenWith(path, c.opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m.rlock()
+	info, err := m.file.Stat()
+	m.RUnlock()
+	if err != nil {
+		m.Close()
+		return nil, nil, errors.Wrap(err, "could not stat file").Set("name", path)
+	}
+
+	return m, info, nil
+}
+
+// Release gives up a map returned by Get. The map must not be used afterwards.
+// It returns an error if closing the map fails.
+func (c *Cache) Release(m *Map) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e := c.maps[m]
+	if e == nil || e.refs < 1 {
+		return errors.New("map not from cache").Set("name", m.Name())
+	}
+
+	e.refs--
+	e.gen++
+	if e.refs > 0 {
+		return nil
+	}
+
+	if c.closed || c.ttl <= 0 || c.entries[e.path] != e {
+		return c.remove(e)
+	}
+
+	gen := e.gen
+	time.AfterFunc(c.ttl, func() {
+		c.expire(e, gen)
+	})
+
+	return nil
+}
+
+// Close closes all maps that aren't in use. Maps that are still in use are
+// closed when they are released. Get fails after the cache is closed.
+func (c *Cache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+
+	var err error
+	for _, e := range c.entries {
+		if e.refs > 0 {
+			continue
+		}
+		cerr := c.remove(e)
+		if cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+// expire closes an entry that has been idle for the TTL, unless it was used
+// since the timer was started.
+func (c *Cache) expire(e *cacheEntry, gen int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e.refs == 0 && e.gen == gen && c.maps[e.m] == e {
+		c.remove(e)
+	}
+}
+
+// evict removes an entry for a file that has been replaced, closing its map if
+// it isn't in use. Lock the cache before calling.
+func (c *Cache) evict(e *cacheEntry) {
+	if c.entries[e.path] == e {
+		delete(c.entries, e.path)
+	}
+
+	if e.refs == 0 {
+		c.remove(e)
+	}
+}
+
+// remove closes the map of an entry and forgets it. Lock the cache before calling.
+func (c *Cache) remove(e *cacheEntry) error {
+	if c.entries[e.path] == e {
+		delete(c.entries, e.path)
+	}
+	delete(c.maps, e.m)
+
+	return e.m.Close()
+}
+
+// sameVersion reports if a and b describe the same version of the same file.
+func sameVersion(a os.FileInfo, b os.FileInfo) bool {
+	return os.SameFile(a, b) && a.Size() == b.Size() && a.ModTime().Equal(b.ModTime())
+}
@@ -0,0 +1,135 @@
+package mmap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "map")
+	ioutil.WriteFile(name, []byte("one"), 0600)
+
+	c := NewCache(200 * time.Millisecond)
+	defer c.Close()
+
+	a, err := c.Get(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Writeable() {
+		t.Fatal("Get returned a writeable map")
+	}
+	b, _ := c.Get(name)
+	if b != a {
+		t.Fatal("Get didn't share the map")
+	}
+
+	// A replaced file is mapped again, and the old map is closed once it is
+	// released by everyone using it.
+	temp := filepath.Join(dir, "temp")
+	ioutil.WriteFile(temp, []byte("two!"), 0600)
+	os.Rename(temp, name)
+
+	d, _ := c.Get(name)
+	if d == a || d.Size() != 4 {
+		t.Fatal("Get didn't map the replaced file")
+	}
+	c.Release(a)
+	if a.Closed() {
+		t.Fatal("map of a replaced file closed while in use")
+	}
+	c.Release(b)
+	if !a.Closed() {
+		t.Fatal("map of a replaced file wasn't closed when released")
+	}
+
+	// A released map stays open for the TTL and can be used again.
+	c.Release(d)
+	if d.Closed() {
+		t.Fatal("map closed before the TTL")
+	}
+	e, _ := c.Get(name)
+	if e != d {
+		t.Fatal("Get didn't reuse an idle map")
+	}
+	c.Release(e)
+
+	for deadline := time.Now().Add(5 * time.Second); !d.Closed(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("idle map wasn't closed after the TTL")
+		}
+	}
+	if err := c.Release(d); err == nil {
+		t.Fatal("Release of an expired map succeeded")
+	}
+
+	// Maps in use when the cache is closed are closed when released.
+	f, _ := c.Get(name)
+	c.Close()
+	if f.Closed() {
+		t.Fatal("map closed with the cache while in use")
+	}
+	c.Release(f)
+	if !f.Closed() {
+		t.Fatal("map wasn't closed when released after the cache was closed")
+	}
+	if _, err := c.Get(name); err == nil {
+		t.Fatal("Get on a closed cache succeeded")
+	}
+}
+
+func TestCacheConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "map")
+	ioutil.WriteFile(name, []byte("one"), 0600)
+
+	c := NewCache(0)
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	maps := make([]*Map, 16)
+	for i := range maps {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			m, err := c.Get(name)
+			if err != nil {
+				t.Error(err)
+			}
+			maps[i] = m
+		}(i)
+	}
+	wg.Wait()
+
+	for _, m := range maps {
+		if m != maps[0] {
+			t.Fatal("concurrent Gets didn't share the map")
+		}
+	}
+
+	// Without a TTL, the map is closed when the last user releases it.
+	for _, m := range maps {
+		if maps[0].Closed() {
+			t.Fatal("map closed while in use")
+		}
+		c.Release(m)
+	}
+	if !maps[0].Closed() {
+		t.Fatal("map wasn't closed when released")
+	}
+}
@@ -3,8 +3,10 @@ package mmap
 // Lock the map before calling closeDirects
 func (m *Map) closeDirects() {
 	for addr, direct := range m.direct {
+		m.freeDirect(*direct)
 		*direct = nil
 		delete(m.direct, addr)
+		m.hookAccessor(DirectAccessor, false)
 	}
 }
 
@@ -24,22 +26,61 @@ func (m *Map) closeWriters() {
 
 // Close closes the memory map and returns an error if any.
 func (m *Map) Close() error {
-	m.Lock()
+	m.lock()
 	defer m.Unlock()
 
-	if m.data == nil {
+	if m.data == nil && m.file == nil {
 		return nil
 	}
 
-	m.closeDirects()
-	m.closeWriters()
-	m.closeReaders()
+	err := m.closeMap()
+	m.hookError("close", err)
+	if m.hooks != nil && m.hooks.Close != nil {
+		m.hooks.Close(m.Name(), err)
+	}
+
+	return err
+}
 
-	err := m.unmap()
+// closeMap closes the map. Lock the map before calling.
+func (m *Map) closeMap() error {
+	err := m.checkLeases()
 	if err != nil {
-		return errors.Wrap(err, "unmap error during close").Set("name", m.name)
+		return errors.Wrap(err, "cannot close map").Set("name", m.Name())
 	}
-	return nil
+
+	// A failed resize can leave the file open without a mapping.
+	if m.data != nil {
+		if m.durable && m.write && m.file != nil {
+			err = m.msync(m.data, true)
+			if err == nil {
+				err = m.syncFile(false)
+			}
+			if err != nil {
+				err = errors.Wrap(err, "sync error during close").Set("name", m.Name())
+			}
+		}
+
+		m.closeDirects()
+		m.closeWriters()
+		m.closeReaders()
+
+		uerr := m.unmap()
+		if uerr != nil && err == nil {
+			err = errors.Wrap(uerr, "unmap error during close").Set("name", m.Name())
+		}
+	}
+
+	// Anonymous maps have no file.
+	if m.file != nil {
+		cerr := m.file.Close()
+		m.file = nil
+		if cerr != nil && err == nil {
+			err = errors.Wrap(cerr, "error closing file").Set("name", m.Name())
+		}
+	}
+
+	return err
 }
 
 // Lock map and close all direct, writers, and readers before calling.
@@ -47,9 +88,14 @@ func (m *Map) unmap() error {
 	data := m.data
 	m.data = nil
 
+	if m.reserve != nil {
+		data = m.reserve
+		m.reserve = nil
+	}
+
 	err := munmap(data)
 	if err != nil {
-		return errors.Wrap(err, "error unmapping memory").Set("name", m.name)
+		return errors.Wrap(err, "error unmapping memory").Set("name", m.Name())
 	}
 
 	return nil
@@ -0,0 +1,252 @@
+package mmap
+
+import (
+	"context"
+	"io"
+	"unsafe"
+)
+
+// contextChunk is the number of bytes copied while holding the map lock by
+// the context aware methods.
+const contextChunk = 1 << 20
+
+// ReadContext is like Read, but copies in chunks and releases the map lock
+// between them so other goroutines can use the map during large reads.
+// It stops when ctx is done and returns the number of bytes read along with
+// the context's error. If the Reader or the map is closed between chunks, it
+// returns the number of bytes read with an error.
+func (r *Reader) ReadContext(ctx context.Context, b []byte) (n int, err error) {
+	r.access.Lock()
+	defer r.access.Unlock()
+
+	r.unread = 0
+
+	for {
+		err = ctx.Err()
+		if err != nil {
+			return n, err
+		}
+
+		r.rlock()
+
+		data, err := r.view()
+		if err != nil {
+			r.RUnlock()
+			return n, err
+		}
+
+		if len(data) <= r.offset {
+			r.RUnlock()
+			if n == 0 && len(b) > 0 {
+				return 0, io.EOF
+			}
+			return n, nil
+		}
+
+		chunk := b[n:]
+		if len(chunk) > contextChunk {
+			chunk = chunk[:contextChunk]
+		}
+
+		err = r.checkProtect(r.base+r.offset, minInt(len(chunk), len(data)-r.offset), false)
+		if err != nil {
+			r.RUnlock()
+			return n, err
+		}
+
+		c := copy(chunk, data[r.offset:])
+		r.offset += c
+		n += c
+		r.stats.addRead(c)
+
+		r.RUnlock()
+
+		if n == len(b) || c < len(chunk) {
+			return n, nil
+		}
+	}
+}
+
+// WriteContext is like Write, but copies in chunks and releases the map lock
+// between them so other goroutines can use the map during large writes.
+// It stops when ctx is done and returns the number of bytes written along with
+// the context's error.
+func (w *Writer) WriteContext(ctx context.Context, b []byte) (n int, err error) {
+	w.access.Lock()
+	defer w.access.Unlock()
+
+	w.unread = 0
+
+	for n < len(b) {
+		err = ctx.Err()
+		if err != nil {
+			return n, err
+		}
+
+		w.lock()
+
+		data, err := w.view()
+		if err != nil {
+			w.Unlock()
+			return n, err
+		}
+
+		if len(data) <= w.offset {
+			w.Unlock()
+			if n == 0 {
+				return 0, io.EOF
+			}
+			return n, io.ErrShortWrite
+		}
+
+		chunk := b[n:]
+		if len(chunk) > contextChunk {
+			chunk = chunk[:contextChunk]
+		}
+
+		err = w.checkProtect(w.base+w.offset, minInt(len(chunk), len(data)-w.offset), true)
+		if err != nil {
+			w.Unlock()
+			return n, err
+		}
+
+		w.preserve(w.base+w.offset, len(chunk))
+		c := copy(data[w.offset:], chunk)
+		w.offset += c
+		n += c
+		w.stats.addWritten(c)
+
+		if w.wsync {
+			err = w.msync(w.data, true)
+			if err != nil {
+				w.Unlock()
+				return n, errors.Wrap(err, "sync error").Set("name", w.Name())
+			}
+		}
+
+		w.Unlock()
+	}
+
+	return n, nil
+}
+
+// CopyRange copies size bytes from src, starting at srcOffset, to the Writer at
+// dstOffset without an intermediate buffer. The Reader may belong to another
+// map. Offsets are relative to the sections of src and the Writer, if any, and
+// neither offset is changed. Overlapping ranges of the same map are handled.
+//
+// Like WriteContext, the bytes are copied in chunks with the map locks released
+// between them. CopyRange stops when ctx is done and returns the number of bytes
+// copied along with the context's error. The copied bytes are the first n bytes
+// of the range, except when the ranges are in the same map and the destination
+// starts after the source. Then the range is copied from its end to keep the
+// source intact, and the copied bytes are the last n bytes of the range. In both
+// cases, the rest of the range can be copied by calling CopyRange again with
+// size-n, and with both offsets advanced by n in the first case.
+func (w *Writer) CopyRange(ctx context.Context, src *Reader, srcOffset int, dstOffset int, size int) (n int, err error) {
+	if size < 1 {
+		return 0, errors.New("size must be greater than zero").Set("name", w.Name()).
+			Set("size", size)
+	}
+
+	w.access.RLock()
+	defer w.access.RUnlock()
+
+	if src != w.Reader {
+		src.access.RLock()
+		defer src.access.RUnlock()
+	}
+
+	// Copy backward when moving data to a higher offset in the same map so
+	// that chunks aren't overwritten before they are copied.
+	backward := src.Map == w.Map && src.base+srcOffset < w.base+dstOffset
+
+	for n < size {
+		err = ctx.Err()
+		if err != nil {
+			return n, err
+		}
+
+		unlock := lockPair(w.Map, src.Map)
+
+		dst, err := w.view()
+		if err != nil {
+			unlock()
+			return n, err
+		}
+
+		from, err := src.view()
+		if err != nil {
+			unlock()
+			return n, err
+		}
+
+		if srcOffset < 0 || dstOffset < 0 ||
+			len(from) < srcOffset+size || len(dst) < dstOffset+size {
+			unlock()
+			return n, errors.New("range out of bounds").Set("name", w.Name()).
+				Set("src_offset", srcOffset).Set("dst_offset", dstOffset).Set("size", size).
+				Set("src_size", len(from)).Set("dst_size", len(dst))
+		}
+
+		c := size - n
+		if c > contextChunk {
+			c = contextChunk
+		}
+
+		start := n
+		if backward {
+			start = size - n - c
+		}
+
+		err = src.checkProtect(src.base+srcOffset+start, c, false)
+		if err == nil {
+			err = w.checkProtect(w.base+dstOffset+start, c, true)
+		}
+		if err != nil {
+			unlock()
+			return n, err
+		}
+
+		w.preserve(w.base+dstOffset+start, c)
+		copy(dst[dstOffset+start:dstOffset+start+c], from[srcOffset+start:srcOffset+start+c])
+		n += c
+		src.stats.addRead(c)
+		w.stats.addWritten(c)
+
+		if w.wsync {
+			err = w.msync(w.data, true)
+			if err != nil {
+				unlock()
+				return n, errors.Wrap(err, "sync error").Set("name", w.Name())
+			}
+		}
+
+		unlock()
+	}
+
+	return n, nil
+}
+
+// lockPair locks dst for writing and src for reading, in a consistent order so
+// that concurrent copies between the same maps can't deadlock. It returns the
+// function that unlocks them.
+func lockPair(dst *Map, src *Map) func() {
+	if dst == src {
+		dst.lock()
+		return dst.Unlock
+	}
+
+	if uintptr(unsafe.Pointer(dst)) < uintptr(unsafe.Pointer(src)) {
+		dst.lock()
+		src.rlock()
+	} else {
+		src.rlock()
+		dst.lock()
+	}
+
+	return func() {
+		src.RUnlock()
+		dst.Unlock()
+	}
+}
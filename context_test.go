@@ -0,0 +1,40 @@
+package mmap
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestReadContextClose(t *testing.T) {
+	size := 64 << 20
+	m, err := Anonymous(size, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, _ := m.Reader()
+
+	read := make(chan error, 1)
+	go func() {
+		_, err := r.ReadContext(context.Background(), make([]byte, size))
+		read <- err
+	}()
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- m.Close()
+	}()
+
+	for _, c := range []chan error{read, closed} {
+		select {
+		case <-c:
+		case <-time.After(10 * time.Second):
+			t.Fatal("ReadContext and Close deadlocked")
+		}
+	}
+
+	if !m.Closed() {
+		t.Fatal("map not closed")
+	}
+}
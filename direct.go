@@ -1,6 +1,7 @@
 package mmap
 
 import (
+	"sync/atomic"
 	"unsafe"
 )
 
@@ -27,15 +28,15 @@ type Direct *[]byte
 
 // Direct creates a Direct slice to the entire memory map.
 func (m *Map) Direct() (Direct, error) {
-	m.Lock()
+	m.lock()
 	defer m.Unlock()
 
 	if m.data == nil {
-		return nil, errors.New("mmap closed").Set("name", m.name)
+		return nil, errors.New("mmap closed").Set("name", m.Name())
 	}
 
 	if len(m.readers) > 0 || len(m.writers) > 0 {
-		return nil, errors.New("mmap has open readers and/or writers").Set("name", m.name)
+		return nil, errors.New("mmap has open readers and/or writers").Set("name", m.Name())
 	}
 
 	direct := m.data
@@ -43,46 +44,45 @@ func (m *Map) Direct() (Direct, error) {
 	addr := uintptr(unsafe.Pointer(&direct))
 
 	m.direct[addr] = &direct
+	atomic.AddInt64(&m.stats.directs, 1)
+	m.hookAccessor(DirectAccessor, true)
 
 	return &direct, nil
 }
 
 // DirectAt creates a Direct slice to a region of the memory map specified
 // by offset and size.
+//
+// When built with the mmapdebug tag, the slice is a copy of the region placed
+// right before a guard page, and is copied back to the map when it is freed.
+// Writing past its end faults immediately. See DebugFaults.
 func (m *Map) DirectAt(offset int, size int) (Direct, error) {
-	m.Lock()
+	m.lock()
 	defer m.Unlock()
 
 	if m.data == nil {
-		return nil, errors.New("mmap closed").Set("name", m.name)
+		return nil, errors.New("mmap closed").Set("name", m.Name())
 	}
 
 	if len(m.readers) > 0 || len(m.writers) > 0 {
-		return nil, errors.New("mmap has open readers and/or writers").Set("name", m.name)
-	}
-
-	if offset < 0 || len(m.data) <= offset {
-		return nil, errors.New("offset out of range").Set("name", m.name).
-			Set("offset", offset).Set("mmap_size", len(m.data))
+		return nil, errors.New("mmap has open readers and/or writers").Set("name", m.Name())
 	}
 
-	if size < 1 {
-		return nil, errors.New("size must be greater than zero").Set("name", m.name).
-			Set("size", size)
+	err := m.checkRegion(offset, size)
+	if err != nil {
+		return nil, err
 	}
 
-	end := offset + size
-	if end > len(m.data) {
-		return nil, errors.New("size extends past end of map").Set("name", m.name).
-			Set("offset", offset).Set("size", size).
-			Set("end", end).Set("mmap_size", len(m.data))
+	direct, err := m.directAt(offset, size)
+	if err != nil {
+		return nil, err
 	}
 
-	direct := m.data[offset:end]
-
 	addr := uintptr(unsafe.Pointer(&direct))
 
 	m.direct[addr] = &direct
+	atomic.AddInt64(&m.stats.directs, 1)
+	m.hookAccessor(DirectAccessor, true)
 
 	return &direct, nil
 }
@@ -93,7 +93,7 @@ func (m *Map) Free(direct Direct) error {
 		return nil
 	}
 
-	m.Lock()
+	m.lock()
 	defer m.Unlock()
 
 	if len(m.direct) == 0 {
@@ -103,11 +103,14 @@ func (m *Map) Free(direct Direct) error {
 	addr := uintptr(unsafe.Pointer(direct))
 
 	if _, ok := m.direct[addr]; !ok {
-		return errors.New("invalid direct value").Set("name", m.name)
+		return errors.New("invalid direct value").Set("name", m.Name())
 	}
 
+	err := m.freeDirect(*direct)
+
 	*direct = nil
 	delete(m.direct, addr)
+	m.hookAccessor(DirectAccessor, false)
 
-	return nil
+	return err
 }
@@ -2,7 +2,14 @@
 Package mmap provides an interface to memory mapped files.
 
 Memory maps can be opened as read-only with Read or read-write with Write.
-To specify additional flags and a file mode use Open.
+To specify additional flags and a file mode use Open. For other settings,
+such as the initial size or access advice, use OpenWith with Options.
+To build a new file before other processes can see it, create it with
+CreateTemp and move it into place with Map.Publish.
+A Cache shares read-only maps of the same files between goroutines.
+A Watcher remaps a file when another process replaces or resizes it.
+A Follower, created with Map.Follow, reads a file as another process appends to it.
+Map.SnapshotReader returns a Reader with a point-in-time view that Writers don't change.
 
 There are two different ways to work with memory maps.
 They cannot be used simultaneously.
@@ -21,6 +28,16 @@ You can have multiple Readers and Writers.
 The map will ensure that writes don't conflict with reads. That is, the underlying map
 won't change during the middle of a read.
 
+SectionReader and SectionWriter create Readers and Writers bound to a region of the map.
+Their offsets, Seek and io.EOF are relative to the region and they cannot access anything
+outside of it.
+
+Reader.Borrow returns a slice pointing directly into the map for parsing in place.
+Truncate and Close fail until every borrowed slice has been released.
+
 When the map is resized via Truncate, all open Direct, Reader, and Writer objects are closed.
+
+Building with the mmapdebug tag places each DirectAt slice right before a guard page, so writing
+past its end faults immediately instead of corrupting the neighboring data.
 */
 package mmap
@@ -0,0 +1,55 @@
+package mmap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDurable(t *testing.T) {
+	for _, durable := range []bool{false, true} {
+		dir, err := ioutil.TempDir("", "mmap")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		syncs := 0
+		opts := []Option{WithCreate(), WithHooks(&Hooks{
+			Sync: func(name string, offset int, size int, duration time.Duration, err error) {
+				syncs++
+			},
+		})}
+		if durable {
+			opts = append(opts, WithDurable())
+		}
+
+		name := filepath.Join(dir, "map")
+		m, err := OpenWith(name, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w, _ := m.Writer()
+		w.WriteString("abc")
+
+		// The directory is synced after the file is resized, so resizing fails
+		// once it's gone.
+		os.RemoveAll(dir)
+		err = m.Truncate(8192)
+		if durable != (err != nil) {
+			t.Fatalf("Truncate of a map in a removed directory returned %v, durable %v", err, durable)
+		}
+
+		// Close flushes the map.
+		syncs = 0
+		if err := m.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if durable != (syncs > 0) {
+			t.Fatalf("Close synced the map %d times, durable %v", syncs, durable)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package mmap
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// followInterval is how often a Follower polls the file for growth when no
+// interval is given and file notifications aren't available.
+const followInterval = 250 * time.Millisecond
+
+// Follower is a Reader that follows a file written by another process, like
+// tail -f. When Read, ReadByte or WriteTo reach the end of the map, they wait
+// for the file to grow, remap it with Map.Reload and continue. They return
+// io.EOF only when the context of the Follower ends or it is closed. Seek and
+// the other methods of Reader work on the map as it is at the time.
+type Follower struct {
+	*Reader
+	ctx      context.Context
+	interval time.Duration
+	mu       sync.Mutex
+	n        *notifier
+	done     chan struct{}
+	stopped  chan struct{}
+	once     sync.Once
+}
+
+// Follow returns a Follower for the map that stops waiting for more data when
+// ctx ends. If interval is zero, growth is detected with inotify on Linux and
+// by polling elsewhere, otherwise the file is polled at that interval.
+func (m *Map) Follow(ctx context.Context, interval time.Duration) (*Follower, error) {
+	if m.file == nil {
+		return nil, errors.New("cannot follow anonymous map").Set("name", m.Name())
+	}
+
+	r, err := m.Reader()
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Follower{
+		Reader:   r,
+		ctx:      ctx,
+		interval: interval,
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+
+	if interval <= 0 {
+		f.interval = followInterval
+
+		f.n, err = newNotifier(filepath.Dir(m.Name()))
+		if err != nil && err != errUnsupported {
+			r.Close()
+			return nil, errors.Wrap(err, "could not watch file").Set("name", m.Name())
+		}
+	}
+
+	if f.n == nil {
+		close(f.stopped)
+	} else {
+		go func() {
+			defer close(f.stopped)
+			select {
+			case <-ctx.Done():
+				f.n.stop()
+			case <-f.done:
+			}
+		}()
+	}
+
+	return f, nil
+}
+
+// Read reads up to len(b) bytes, waiting for the file to grow if the Follower
+// is at the end of the map.
+func (f *Follower) Read(b []byte) (n int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for {
+		n, err = f.Reader.Read(b)
+		if err != io.EOF {
+			return n, err
+		}
+
+		err = f.wait()
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// ReadByte reads a byte, waiting for the file to grow if the Follower is at
+// the end of the map.
+func (f *Follower) ReadByte() (byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for {
+		b, err := f.Reader.ReadByte()
+		if err != io.EOF {
+			return b, err
+		}
+
+		err = f.wait()
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// WriteTo writes the file to w as it grows, until the context of the Follower
+// ends or an error occurs.
+func (f *Follower) WriteTo(w io.Writer) (n int64, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for {
+		m, err := f.Reader.WriteTo(w)
+		n += m
+		if err != nil {
+			return n, err
+		}
+
+		err = f.wait()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+// Close stops waiting for data and closes the Follower.
+func (f *Follower) Close() error {
+	f.once.Do(func() {
+		close(f.done)
+		if f.n != nil {
+			f.n.stop()
+		}
+	})
+	<-f.stopped
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.n != nil {
+		f.n.close()
+		f.n = nil
+	}
+
+	return f.Reader.Close()
+}
+
+// wait blocks until the file changes size. It returns io.EOF when the context
+// ends or the Follower is closed. Lock the Follower before calling.
+func (f *Follower) wait() error {
+	for {
+		select {
+		case <-f.ctx.Done():
+			return io.EOF
+		case <-f.done:
+			return io.EOF
+		default:
+		}
+
+		changed, err := f.Map.Reload()
+		if err != nil {
+			return err
+		}
+		if changed {
+			return nil
+		}
+
+		if f.n != nil {
+			names, err := f.n.wait()
+			if err != nil {
+				return errors.Wrap(err, "error watching file").Set("name", f.Name())
+			}
+			if names == nil {
+				return io.EOF
+			}
+			continue
+		}
+
+		select {
+		case <-f.ctx.Done():
+			return io.EOF
+		case <-f.done:
+			return io.EOF
+		case <-time.After(f.interval):
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package mmap
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// appendSlowly appends each of parts to the file name after a pause, then
+// waits a little longer and calls done.
+func appendSlowly(name string, parts []string, done func()) {
+	for _, s := range parts {
+		time.Sleep(50 * time.Millisecond)
+		file, _ := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0)
+		file.WriteString(s)
+		file.Close()
+	}
+	time.Sleep(100 * time.Millisecond)
+	done()
+}
+
+func testFollow(t *testing.T, interval time.Duration) {
+	dir, err := ioutil.TempDir("", "mmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "map")
+	ioutil.WriteFile(name, []byte("a"), 0600)
+
+	m, err := Read(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	f, err := m.Follow(ctx, interval)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Read returns io.EOF only when the context ends.
+	go appendSlowly(name, []string{"bc", "def"}, cancel)
+
+	var buf bytes.Buffer
+	n, err := buf.ReadFrom(f)
+	if n != 6 || err != nil || buf.String() != "abcdef" {
+		t.Fatalf("read %q, %v, want %q, nil", buf.String(), err, "abcdef")
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// So does WriteTo, and ReadByte waits for the file to grow.
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	f, err = m.Follow(ctx, interval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.Seek(5, SeekStart)
+	go appendSlowly(name, []string{"g", "hi"}, cancel)
+
+	if c, err := f.ReadByte(); c != 'f' || err != nil {
+		t.Fatalf("ReadByte returned %q, %v, want 'f', nil", c, err)
+	}
+	if c, err := f.ReadByte(); c != 'g' || err != nil {
+		t.Fatalf("ReadByte returned %q, %v, want 'g', nil", c, err)
+	}
+
+	buf.Reset()
+	n, err = f.WriteTo(&buf)
+	if n != 2 || err != nil || buf.String() != "hi" {
+		t.Fatalf("WriteTo wrote %q, %v, want %q, nil", buf.String(), err, "hi")
+	}
+}
+
+func TestFollowNotify(t *testing.T) {
+	testFollow(t, 0)
+}
+
+func TestFollowPoll(t *testing.T) {
+	testFollow(t, 10*time.Millisecond)
+}
+
+func TestFollowClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "map")
+	ioutil.WriteFile(name, []byte("a"), 0600)
+
+	m, err := Read(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	f, err := m.Follow(context.Background(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := ioutil.ReadAll(f)
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	go f.Close()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close didn't stop a waiting Read")
+	}
+
+	a, err := Anonymous(100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	if _, err := a.Follow(context.Background(), 0); err == nil {
+		t.Fatal("Follow of an anonymous map succeeded")
+	}
+}
@@ -0,0 +1,24 @@
+//go:build !mmapdebug
+// +build !mmapdebug
+
+package mmap
+
+// directAt returns the region of the map for a Direct slice.
+// Lock the map and check the region before calling.
+func (m *Map) directAt(offset int, size int) ([]byte, error) {
+	return m.data[offset : offset+size : offset+size], nil
+}
+
+// freeDirect releases the memory of a Direct slice. Lock the map before calling.
+func (m *Map) freeDirect(direct []byte) error {
+	return nil
+}
+
+// DebugFaults is used with the mmapdebug build tag to report writes past the
+// end of Direct slices. Without the tag it does nothing.
+//
+//     defer mmap.DebugFaults()()
+//
+func DebugFaults() func() {
+	return func() {}
+}
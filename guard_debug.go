@@ -0,0 +1,133 @@
+//go:build mmapdebug
+// +build mmapdebug
+
+package mmap
+
+import (
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sync"
+)
+
+// guard is a copy of a region of a map given out as a Direct slice, surrounded
+// by pages that can't be accessed.
+type guard struct {
+	m      *Map
+	offset int
+	region []byte // the whole mapping, including the guard pages
+	data   []byte // the copy of the map region
+}
+
+// guards holds the guarded Direct slices by the address of their data.
+var guards = struct {
+	sync.Mutex
+	byAddr map[uintptr]*guard
+}{byAddr: make(map[uintptr]*guard)}
+
+// directAt copies a region of the map to memory between two guard pages for a
+// Direct slice. The copy ends right before the second guard page, so writing
+// past its end faults. Lock the map and check the region before calling.
+func (m *Map) directAt(offset int, size int) ([]byte, error) {
+	page := os.Getpagesize()
+	pages := (size + page - 1) / page * page
+
+	region, err := reserve(pages + 2*page)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not reserve guarded region").Set("name", m.Name()).
+			Set("offset", offset).Set("size", size)
+	}
+
+	_, err = mmapAnonFixed(dataAddr(region[page:]), pages, 0)
+	if err != nil {
+		munmap(region)
+		return nil, errors.Wrap(err, "could not map guarded region").Set("name", m.Name()).
+			Set("offset", offset).Set("size", size)
+	}
+
+	start := page + pages - size
+	data := region[start : start+size : start+size]
+	copy(data, m.data[offset:offset+size])
+
+	guards.Lock()
+	guards.byAddr[dataAddr(data)] = &guard{m: m, offset: offset, region: region, data: data}
+	guards.Unlock()
+
+	return data, nil
+}
+
+// freeDirect copies a guarded Direct slice back to the map and unmaps it.
+// Lock the map before calling.
+func (m *Map) freeDirect(direct []byte) error {
+	if len(direct) == 0 {
+		return nil
+	}
+
+	guards.Lock()
+	g, ok := guards.byAddr[dataAddr(direct)]
+	delete(guards.byAddr, dataAddr(direct))
+	guards.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	if m.data != nil && g.offset+len(g.data) <= len(m.data) {
+		copy(m.data[g.offset:], g.data)
+	}
+
+	err := munmap(g.region)
+	if err != nil {
+		return errors.Wrap(err, "could not unmap guarded region").Set("name", m.Name()).
+			Set("offset", g.offset).Set("size", len(g.data))
+	}
+
+	return nil
+}
+
+// DebugFaults makes a fault in the calling goroutine panic instead of crashing
+// the program. The returned function must be deferred. If the fault was caused
+// by accessing the guard pages of a Direct slice, it panics again with a message
+// naming the map and region.
+//
+//     defer mmap.DebugFaults()()
+//
+func DebugFaults() func() {
+	old := debug.SetPanicOnFault(true)
+
+	return func() {
+		debug.SetPanicOnFault(old)
+
+		r := recover()
+		if r == nil {
+			return
+		}
+
+		fault, ok := r.(interface{ Addr() uintptr })
+		if !ok {
+			panic(r)
+		}
+
+		addr := fault.Addr()
+
+		guards.Lock()
+		defer guards.Unlock()
+
+		for _, g := range guards.byAddr {
+			start, end := dataAddr(g.region), dataAddr(g.region)+uintptr(len(g.region))
+			if addr < start || end <= addr {
+				continue
+			}
+
+			where := "past the end of"
+			if addr < dataAddr(g.data) {
+				where = "before the start of"
+			}
+
+			panic(fmt.Sprintf("mmap: access %s Direct slice at address %#x: map %q, offset %d, size %d",
+				where, addr, g.m.Name(), g.offset, len(g.data)))
+		}
+
+		panic(r)
+	}
+}
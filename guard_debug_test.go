@@ -0,0 +1,45 @@
+//go:build mmapdebug
+// +build mmapdebug
+
+package mmap
+
+import (
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+func TestGuardPages(t *testing.T) {
+	m, done := tempMap(t, 8192)
+	defer done()
+
+	d, err := m.DirectAt(10, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(*d, "guarded")
+
+	// The byte past the end of the slice is on a guard page.
+	msg := func() (msg string) {
+		defer func() {
+			msg, _ = recover().(string)
+		}()
+		defer DebugFaults()()
+
+		past := (*byte)(unsafe.Pointer(uintptr(unsafe.Pointer(&(*d)[99])) + 1))
+		*past = 1
+		return ""
+	}()
+	if !strings.Contains(msg, "past the end of Direct slice") || !strings.Contains(msg, "offset 10, size 100") {
+		t.Fatalf("write past the end of a Direct slice panicked with %q", msg)
+	}
+
+	// Changes are copied back to the map when the slice is freed.
+	if err := m.Free(d); err != nil {
+		t.Fatal(err)
+	}
+	r, _ := m.Reader()
+	if eq, _ := r.Equal(10, []byte("guarded")); !eq {
+		t.Fatal("changes to a guarded Direct slice weren't copied to the map")
+	}
+}
@@ -0,0 +1,73 @@
+package mmap
+
+import (
+	"time"
+)
+
+// Hooks are callbacks for events in the lifecycle of a Map, used for tracing and
+// logging. They are set with WithHooks and any of them may be nil. Hooks are called
+// with the map locked, so they must not call methods of the Map.
+type Hooks struct {
+	// Open is called after the map is opened.
+	Open func(name string, size int)
+
+	// Close is called after the map is closed, with the error returned by Close.
+	Close func(name string, err error)
+
+	// Truncate is called after the map is resized by Truncate or a Writer.
+	Truncate func(name string, oldSize int, newSize int, err error)
+
+	// Sync is called after changes to a range of the map are flushed.
+	Sync func(name string, offset int, size int, duration time.Duration, err error)
+
+	// AccessorOpen and AccessorClose are called when a Reader, Writer or Direct
+	// slice is created and closed.
+	AccessorOpen  func(name string, kind AccessorKind)
+	AccessorClose func(name string, kind AccessorKind)
+
+	// Error is called when opening, closing, resizing, syncing or publishing the
+	// map fails. The operation is "open", "close", "truncate", "sync" or "publish".
+	Error func(name string, op string, err error)
+}
+
+// AccessorKind is the type of accessor passed to Hooks.
+type AccessorKind int
+
+// Kinds of accessors.
+const (
+	ReaderAccessor AccessorKind = iota // a Reader
+	WriterAccessor                     // a Writer
+	DirectAccessor                     // a Direct slice
+)
+
+func (k AccessorKind) String() string {
+	switch k {
+	case ReaderAccessor:
+		return "reader"
+	case WriterAccessor:
+		return "writer"
+	case DirectAccessor:
+		return "direct"
+	default:
+		return "unknown"
+	}
+}
+
+// hookAccessor calls the AccessorOpen or AccessorClose hook.
+func (m *Map) hookAccessor(kind AccessorKind, open bool) {
+	h := m.hooks
+	switch {
+	case h == nil:
+	case open && h.AccessorOpen != nil:
+		h.AccessorOpen(m.Name(), kind)
+	case !open && h.AccessorClose != nil:
+		h.AccessorClose(m.Name(), kind)
+	}
+}
+
+// hookError calls the Error hook if err is not nil.
+func (m *Map) hookError(op string, err error) {
+	if err != nil && m.hooks != nil && m.hooks.Error != nil {
+		m.hooks.Error(m.Name(), op, err)
+	}
+}
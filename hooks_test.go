@@ -0,0 +1,51 @@
+package mmap
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHooks(t *testing.T) {
+	var events []string
+	hooks := &Hooks{
+		Open: func(name string, size int) {
+			events = append(events, "open")
+		},
+		Close: func(name string, err error) {
+			events = append(events, "close")
+		},
+		Truncate: func(name string, oldSize int, newSize int, err error) {
+			events = append(events, "truncate")
+		},
+		Sync: func(name string, offset int, size int, duration time.Duration, err error) {
+			events = append(events, "sync")
+		},
+		AccessorOpen: func(name string, kind AccessorKind) {
+			events = append(events, "+"+kind.String())
+		},
+		AccessorClose: func(name string, kind AccessorKind) {
+			events = append(events, "-"+kind.String())
+		},
+		Error: func(name string, op string, err error) {
+			events = append(events, op+" error")
+		},
+	}
+
+	m, done := tempMap(t, 100, WithHooks(hooks))
+	defer done()
+
+	w, _ := m.Writer()
+	w.Close()
+	m.Reader()
+	m.Truncate(200)
+	d, _ := m.Direct()
+	m.Free(d)
+	m.Close()
+
+	got := strings.Join(events, " ")
+	want := "open +writer -writer +reader -reader sync truncate +direct -direct close"
+	if got != want {
+		t.Fatalf("hooks called for %q, want %q", got, want)
+	}
+}
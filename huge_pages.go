@@ -0,0 +1,91 @@
+package mmap
+
+import (
+	"os"
+)
+
+// SetHugePages requests transparent huge pages for the map. When enabled, the
+// map is moved to an address aligned to the huge page size and the kernel is
+// advised to back it with huge pages, and Truncate rounds sizes up to a
+// multiple of the huge page size. Any open Direct slices are closed.
+//
+// Transparent huge pages are only available on Linux, and whether they are
+// used for file backed maps depends on the file system and kernel settings.
+// Maps on hugetlbfs and anonymous maps created with a huge page size already
+// use huge pages and can't be changed.
+func (m *Map) SetHugePages(enable bool) error {
+	m.lock()
+	defer m.Unlock()
+
+	if m.data == nil {
+		return errors.New("mmap closed").Set("name", m.Name())
+	}
+
+	if m.thp == enable {
+		return nil
+	}
+
+	if m.reserve != nil {
+		return errors.New("cannot move map with reserved address space").Set("name", m.Name())
+	}
+
+	if m.hugetlb != 0 || (!m.thp && m.page > os.Getpagesize()) {
+		return errors.New("map is backed by hugetlb pages").Set("name", m.Name())
+	}
+
+	size := os.Getpagesize()
+	if enable {
+		size = transparentHugePageSize()
+		if size == 0 {
+			return errors.New("transparent huge pages are not supported").Set("name", m.Name())
+		}
+	}
+
+	err := m.checkLeases()
+	if err != nil {
+		return errors.Wrap(err, "cannot move map to huge pages").Set("name", m.Name())
+	}
+
+	m.closeDirects()
+
+	thp, page := m.thp, m.page
+	m.thp, m.page = enable, size
+
+	data, err := m.mmap(len(m.data))
+	if err != nil {
+		m.thp, m.page = thp, page
+		return errors.Wrap(err, "could not map huge pages").Set("name", m.Name())
+	}
+
+	if m.file == nil {
+		err = m.copyData(data)
+		if err != nil {
+			munmap(data)
+			m.thp, m.page = thp, page
+			return err
+		}
+	}
+
+	err = m.sync(true)
+	if err == nil {
+		err = munmap(m.data)
+	}
+	if err != nil {
+		munmap(data)
+		m.thp, m.page = thp, page
+		return errors.Wrap(err, "could not replace mapping").Set("name", m.Name())
+	}
+
+	m.data = data
+
+	return m.remapped()
+}
+
+// PageSize returns the page size of the map. This is the huge page size for
+// maps using huge pages and the system page size otherwise.
+func (m *Map) PageSize() int {
+	m.rlock()
+	defer m.RUnlock()
+
+	return m.page
+}
@@ -0,0 +1,72 @@
+package mmap
+
+import (
+	"os"
+	"testing"
+)
+
+func TestHugePages(t *testing.T) {
+	a, err := Anonymous(100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	w, _ := a.Writer()
+	w.WriteString("hello")
+
+	if err := a.SetHugePages(true); err != nil {
+		t.Skip("transparent huge pages aren't supported:", err)
+	}
+
+	huge := transparentHugePageSize()
+	if a.PageSize() != huge {
+		t.Fatalf("page size is %d with huge pages, want %d", a.PageSize(), huge)
+	}
+
+	// The contents move with the map, and sizes are rounded up to huge pages.
+	r, _ := a.Reader()
+	if eq, _ := r.Equal(0, []byte("hello")); !eq {
+		t.Fatal("anonymous map lost its contents moving to huge pages")
+	}
+	if err := a.Truncate(int64(huge + 1)); err != nil {
+		t.Fatal(err)
+	}
+	if a.Size() != 2*huge {
+		t.Fatalf("map is %d bytes after Truncate, want %d", a.Size(), 2*huge)
+	}
+
+	if err := a.SetHugePages(false); err != nil {
+		t.Fatal(err)
+	}
+	if a.PageSize() != os.Getpagesize() {
+		t.Fatalf("page size is %d without huge pages, want %d", a.PageSize(), os.Getpagesize())
+	}
+	r, _ = a.Reader()
+	if eq, _ := r.Equal(0, []byte("hello")); !eq {
+		t.Fatal("anonymous map lost its contents moving from huge pages")
+	}
+
+	m, done := tempMap(t, 100)
+	defer done()
+
+	w, _ = m.Writer()
+	w.WriteString("file")
+	if err := m.SetHugePages(true); err != nil {
+		t.Fatal(err)
+	}
+	r, _ = m.Reader()
+	if eq, _ := r.Equal(0, []byte("file")); !eq {
+		t.Fatal("file map lost its contents moving to huge pages")
+	}
+
+	if err := m.SetHugePages(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Reserve(1 << 30); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetHugePages(true); err == nil {
+		t.Fatal("SetHugePages moved a map with reserved address space")
+	}
+}
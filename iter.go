@@ -0,0 +1,244 @@
+//go:build go1.23
+// +build go1.23
+
+package mmap
+
+import (
+	"bufio"
+	"io"
+	"iter"
+)
+
+// Chunks returns an iterator over consecutive chunks of the map of at most
+// size bytes, each a slice pointing directly into the map. The first chunk
+// starts at offset zero and each of the others where the previous one ended.
+//
+// The map is read locked while each chunk is yielded and unlocked between
+// chunks, so the slice is only valid until the loop body returns. The loop body
+// must not call methods that lock the map for writing. Iteration stops if the map
+// is closed. Chunks end before a region protected against reading, and the
+// error for reading it is yielded with a nil chunk.
+func (m *Map) Chunks(size int) iter.Seq2[[]byte, error] {
+	return func(yield func([]byte, error) bool) {
+		pos := 0
+		chunks(m.lockData, &pos, size)(yield)
+	}
+}
+
+// Lines returns an iterator over the lines of the map, not including the
+// end-of-line bytes. Each line points directly into the map and is only valid
+// until the loop body returns. If a line can't be read because of a protected
+// region, the error is yielded with a nil line and iteration stops. See Chunks
+// for the locking behavior.
+func (m *Map) Lines() iter.Seq2[[]byte, error] {
+	return m.Split(bufio.ScanLines)
+}
+
+// Split returns an iterator over the tokens of the map as determined by split,
+// which has the same semantics as for a bufio.Scanner. Since the entire map is
+// available, split is called with atEOF set to true, unless the rest of the map
+// is cut short by a protected region. If split returns an error other than
+// bufio.ErrFinalToken, or a token can't be read because of a protected region,
+// the error is yielded with a nil token and iteration stops. Each token points
+// directly into the map and is only valid until the loop body returns. See
+// Chunks for the locking behavior.
+func (m *Map) Split(split bufio.SplitFunc) iter.Seq2[[]byte, error] {
+	return func(yield func([]byte, error) bool) {
+		pos := 0
+		tokens(m.lockData, &pos, split)(yield)
+	}
+}
+
+// Chunks is like Map.Chunks, but iterates from the Reader's offset over its
+// section, if any, and advances the offset past each chunk. The loop body must
+// not call methods on the Reader.
+func (r *Reader) Chunks(size int) iter.Seq2[[]byte, error] {
+	return chunks(r.lockData, &r.offset, size)
+}
+
+// Lines is like Map.Lines, but iterates from the Reader's offset over its
+// section, if any, and advances the offset past each line. The loop body must
+// not call methods on the Reader.
+func (r *Reader) Lines() iter.Seq2[[]byte, error] {
+	return r.Split(bufio.ScanLines)
+}
+
+// Split is like Map.Split, but iterates from the Reader's offset over its
+// section, if any, and advances the offset past each token. The loop body must
+// not call methods on the Reader.
+func (r *Reader) Split(split bufio.SplitFunc) iter.Seq2[[]byte, error] {
+	return tokens(r.lockData, &r.offset, split)
+}
+
+// lockFunc locks the data iterated over and returns the part of it that can be
+// read from pos and the function that unlocks it. If the part ends at a region
+// that can't be read, it also returns the error for reading the region. It
+// returns a nil function if the data can't be read at all.
+type lockFunc func(pos int) ([]byte, func(), error)
+
+// lockData read locks the map like a lockFunc.
+func (m *Map) lockData(pos int) ([]byte, func(), error) {
+	m.rlock()
+
+	if m.data == nil {
+		m.RUnlock()
+		return nil, nil, nil
+	}
+
+	data, err := m.readableData(m.data, 0, pos)
+
+	return data, m.RUnlock, err
+}
+
+// lockData locks the Reader and read locks the map like a lockFunc, returning
+// the Reader's view. If the view can't be read, the error is returned with a nil
+// function.
+func (r *Reader) lockData(pos int) ([]byte, func(), error) {
+	r.access.Lock()
+	r.rlock()
+
+	unlock := func() {
+		r.RUnlock()
+		r.access.Unlock()
+	}
+
+	if r.data == nil || r.isClosed() {
+		unlock()
+		return nil, nil, nil
+	}
+
+	data, err := r.view()
+	if err != nil {
+		unlock()
+		return nil, nil, err
+	}
+
+	r.unread = 0
+
+	data, err = r.readableData(data, r.base, pos)
+
+	return data, unlock, err
+}
+
+// readableData cuts data, which is the map or a view of it starting at base,
+// at the first region after pos that can't be read, and returns the error for
+// reading the region. Lock the map before calling.
+func (m *Map) readableData(data []byte, base int, pos int) ([]byte, error) {
+	if len(data) <= pos {
+		return data, nil
+	}
+
+	end := m.readable(base+pos, base+len(data)) - base
+	if end == len(data) {
+		return data, nil
+	}
+
+	return data[:end:end], m.checkProtect(base+end, 1, false)
+}
+
+func chunks(lock lockFunc, pos *int, size int) iter.Seq2[[]byte, error] {
+	return func(yield func([]byte, error) bool) {
+		if size < 1 {
+			return
+		}
+
+		for {
+			offset := *pos
+
+			data, unlock, err := lock(offset)
+			if unlock == nil {
+				if err != nil {
+					yield(nil, err)
+				}
+				return
+			}
+
+			if len(data) <= offset {
+				unlock()
+				if err != nil {
+					yield(nil, err)
+				}
+				return
+			}
+
+			end := offset + size
+			if end < offset || end > len(data) {
+				end = len(data)
+			}
+			*pos = end
+
+			more := yield(data[offset:end:end], nil)
+			unlock()
+
+			if !more {
+				return
+			}
+		}
+	}
+}
+
+func tokens(lock lockFunc, pos *int, split bufio.SplitFunc) iter.Seq2[[]byte, error] {
+	return func(yield func([]byte, error) bool) {
+		for {
+			offset := *pos
+
+			data, unlock, perr := lock(offset)
+			if unlock == nil {
+				if perr != nil {
+					yield(nil, perr)
+				}
+				return
+			}
+
+			if len(data) <= offset {
+				unlock()
+				if perr != nil {
+					yield(nil, perr)
+				}
+				return
+			}
+
+			remaining := data[offset:]
+			advance, token, err := split(remaining[:len(remaining):len(remaining)], perr == nil)
+
+			final := err == bufio.ErrFinalToken
+			if final {
+				err = nil
+			}
+
+			switch {
+			case err != nil:
+			case advance < 0 || len(remaining) < advance:
+				err = errors.New("split function returned invalid advance").
+					Set("advance", advance).Set("remaining", len(remaining))
+			case advance == 0 && token == nil && perr != nil:
+				// The rest of the token is protected.
+				err = perr
+			case advance == 0 && token == nil:
+				unlock()
+				return
+			case advance == 0:
+				// A token without progress would be returned forever.
+				err = io.ErrNoProgress
+			}
+
+			if err != nil {
+				unlock()
+				yield(nil, err)
+				return
+			}
+
+			*pos = offset + advance
+
+			more := true
+			if token != nil {
+				more = yield(token[:len(token):len(token)], nil)
+			}
+			unlock()
+
+			if !more || final {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,152 @@
+//go:build go1.23
+// +build go1.23
+
+package mmap
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestIter(t *testing.T) {
+	m, done := tempMap(t, 22)
+	defer done()
+
+	w, _ := m.Writer()
+	w.WriteString("one two\nthree\r\n\nfour")
+
+	var chunks []string
+	for c, err := range m.Chunks(8) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, string(c))
+	}
+	if got := strings.Join(chunks, "|"); got != "one two\n|three\r\n\n|four\x00\x00" {
+		t.Fatalf("Chunks yielded %q", got)
+	}
+
+	var lines []string
+	for line, err := range m.Lines() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, string(line))
+	}
+	if got := strings.Join(lines, "|"); got != "one two|three||four\x00\x00" {
+		t.Fatalf("Lines yielded %q", got)
+	}
+
+	// ErrFinalToken stops after the token and other errors are yielded.
+	splitErr := errors.New("split error")
+	split := func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanWords(data, atEOF)
+		switch string(token) {
+		case "two":
+			err = bufio.ErrFinalToken
+		case "three":
+			err = splitErr
+		}
+		return advance, token, err
+	}
+	var words []string
+	for word, err := range m.Split(split) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		words = append(words, string(word))
+	}
+	if got := strings.Join(words, "|"); got != "one|two" {
+		t.Fatalf("Split yielded %q", got)
+	}
+
+	// A Reader iterates from its offset and advances it, even when the loop
+	// stops early.
+	r, _ := m.SectionReader(8, 10)
+	r.Seek(7, SeekStart)
+	for line, err := range r.Lines() {
+		if string(line) != "" || err != nil {
+			t.Fatalf("Reader.Lines yielded %q, %v", line, err)
+		}
+		break
+	}
+	if c, _ := r.ReadByte(); c != 'f' {
+		t.Fatalf("read %q after Reader.Lines, want 'f'", c)
+	}
+
+	r.Seek(0, SeekStart)
+	for _, err := range r.Split(split) {
+		if err == nil {
+			continue
+		}
+		if err != splitErr {
+			t.Fatalf("Reader.Split yielded %v, want %v", err, splitErr)
+		}
+		splitErr = nil
+	}
+	if splitErr != nil {
+		t.Fatal("Reader.Split didn't yield the split error")
+	}
+
+	m.Close()
+	for range m.Chunks(8) {
+		t.Fatal("Chunks yielded a chunk of a closed map")
+	}
+}
+
+func TestIterProtected(t *testing.T) {
+	page := os.Getpagesize()
+	m, done := tempMap(t, 3*page)
+	defer done()
+
+	w, _ := m.Writer()
+	w.WriteString(strings.Repeat("line\n", 3*page/5))
+	if err := m.Protect(page, page, ProtectNone); err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	var err error
+	for c, cerr := range m.Chunks(1000) {
+		if cerr != nil {
+			err = cerr
+			break
+		}
+		n += len(c)
+	}
+	if n != page || err == nil {
+		t.Fatalf("Chunks read %d bytes and %v, want %d and an error", n, err, page)
+	}
+
+	lines := 0
+	err = nil
+	for line, lerr := range m.Lines() {
+		if lerr != nil {
+			err = lerr
+			break
+		}
+		if string(line) != "line" {
+			t.Fatalf("read line %q", line)
+		}
+		lines++
+	}
+	if lines != page/5 || err == nil {
+		t.Fatalf("Lines read %d lines and %v, want %d and an error", lines, err, page/5)
+	}
+
+	// A Reader stops at the protected region from its offset.
+	r, _ := m.SectionReader(page/2, page)
+	n, err = 0, nil
+	for c, cerr := range r.Chunks(100) {
+		if cerr != nil {
+			err = cerr
+			break
+		}
+		n += len(c)
+	}
+	if n != page-page/2 || err == nil {
+		t.Fatalf("Reader.Chunks read %d bytes and %v, want %d and an error", n, err, page-page/2)
+	}
+}
@@ -3,6 +3,7 @@ package mmap
 import (
 	"os"
 	"sync"
+	"sync/atomic"
 
 	errorpkg "github.com/go-util/errors"
 )
@@ -22,16 +23,38 @@ func isSet(flags int, bit int) bool {
 	return flags&bit == bit
 }
 
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
 var errors = errorpkg.NewOptions().Caller()
 
 // Map represents a file on disk that has been mapped into memory.
 type Map struct {
 	sync.RWMutex
-	name    string
+	name    atomic.Value // string, changed by Publish
+	file    *os.File
 	data    []byte
 	write   bool
 	wsync   bool
+	grow    bool
+	falloc  bool
+	durable bool
+	page    int
+	thp     bool
+	hugetlb int
+	reserve []byte
+	protect []protection
+	stats   *stats
+	hooks   *Hooks
+	snaps   map[int]*snapshot
+	advice  Advice
+	preload bool
 	id      int
+	leases  int
 	direct  map[uintptr]Direct
 	readers map[int]*Reader
 	writers map[int]*Writer
@@ -39,20 +62,20 @@ type Map struct {
 
 // Read opens a file as a read-only memory map.
 func Read(name string) (*Map, error) {
-	return Open(name, ReadOnly, 0)
+	return OpenWith(name, WithReadOnly())
 }
 
 // Write opens a file as a writeable memory map. It will create the file if it doesn't exist with
 // FileMode 0600.  It does not truncate the file, however if the file size is 0, it will resize
 // the file to be size of a memory page as returned by os.Getpagesize(). If a different size is needed,
-// call Truncate after opening.
+// use OpenWith and WithInitialSize.
 func Write(name string) (*Map, error) {
-	return Open(name, ReadWrite|Create, 0600)
+	return OpenWith(name, WithCreate())
 }
 
 // Size returns the size of the map.
 func (m *Map) Size() int {
-	m.RLock()
+	m.rlock()
 	defer m.RUnlock()
 
 	return len(m.data)
@@ -60,22 +83,94 @@ func (m *Map) Size() int {
 
 // Name returns the name of the backing file.
 func (m *Map) Name() string {
-	return m.name
+	name, _ := m.name.Load().(string)
+	return name
 }
 
 // Writeable indicates if the map is writeable.
 func (m *Map) Writeable() bool {
+	m.rlock()
+	defer m.RUnlock()
+
 	return m.write
 }
 
 // WriteSync indicates if the map uses synchronous writes.
 func (m *Map) WriteSync() bool {
+	m.rlock()
+	defer m.RUnlock()
+
 	return m.wsync
 }
 
+// checkRegion verifies that offset and size describe a non-empty region
+// inside the map. Lock the map and check that it is open before calling.
+func (m *Map) checkRegion(offset int, size int) error {
+	return m.checkRange(m.data, offset, size)
+}
+
+// checkRange verifies that offset and size describe a non-empty region inside
+// data, which is the map or a view of it.
+func (m *Map) checkRange(data []byte, offset int, size int) error {
+	if offset < 0 || len(data) <= offset {
+		return errors.New("offset out of range").Set("name", m.Name()).
+			Set("offset", offset).Set("mmap_size", len(data))
+	}
+
+	if size < 1 {
+		return errors.New("size must be greater than zero").Set("name", m.Name()).
+			Set("size", size)
+	}
+
+	end := offset + size
+	if end < offset || end > len(data) {
+		return errors.New("size extends past end of map").Set("name", m.Name()).
+			Set("offset", offset).Set("size", size).
+			Set("end", end).Set("mmap_size", len(data))
+	}
+
+	return nil
+}
+
+// SetGrow controls whether Writer.ReadFrom may extend the map when it reaches
+// the end. It has no effect on read-only maps or section Writers.
+func (m *Map) SetGrow(grow bool) {
+	m.lock()
+	defer m.Unlock()
+
+	m.grow = grow
+}
+
+// Grow indicates if Writer.ReadFrom may extend the map.
+func (m *Map) Grow() bool {
+	m.rlock()
+	defer m.RUnlock()
+
+	return m.grow
+}
+
+// SetPreallocate controls whether disk space is allocated for the new part of
+// the map before it is extended by Truncate or Writer.ReadFrom. Without it, the
+// file is extended sparsely and writing to the map on a full disk raises SIGBUS
+// instead of returning an error.
+func (m *Map) SetPreallocate(prealloc bool) {
+	m.lock()
+	defer m.Unlock()
+
+	m.falloc = prealloc
+}
+
+// Preallocate indicates if disk space is allocated before the map is extended.
+func (m *Map) Preallocate() bool {
+	m.rlock()
+	defer m.RUnlock()
+
+	return m.falloc
+}
+
 // Closed indicates if the map is closed.
 func (m *Map) Closed() bool {
-	m.RLock()
+	m.rlock()
 	defer m.RUnlock()
 
 	return m.data == nil
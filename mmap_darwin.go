@@ -0,0 +1,69 @@
+package mmap
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// sendfile is not used on darwin. The caller writes from the map instead.
+func sendfile(dst syscall.Conn, file *os.File, offset int64, count int) (int, bool, error) {
+	return 0, false, nil
+}
+
+// zeroRange is not supported on darwin. The caller clears the memory instead.
+func zeroRange(file *os.File, offset int64, size int64) error {
+	return errUnsupported
+}
+
+// punchHole is not supported on darwin.
+func punchHole(file *os.File, offset int64, size int64) error {
+	return errUnsupported
+}
+
+// allocate is not supported on darwin.
+func allocate(file *os.File, offset int64, size int64) error {
+	return errUnsupported
+}
+
+// cloneFile is not supported on darwin.
+func cloneFile(dst *os.File, src *os.File) error {
+	return errUnsupported
+}
+
+// copyFileRange is not supported on darwin.
+func copyFileRange(dst *os.File, src *os.File, size int64) error {
+	return errUnsupported
+}
+
+// fdatasync flushes file with F_FULLFSYNC, as darwin has no fdatasync.
+func fdatasync(file *os.File) error {
+	return file.Sync()
+}
+
+// populate advises the kernel that the pages of data will be needed.
+func populate(data []byte) error {
+	return unix.Madvise(data, unix.MADV_WILLNEED)
+}
+
+// hugetlbFlags is not supported on darwin.
+func hugetlbFlags(size int) (int, error) {
+	return 0, errUnsupported
+}
+
+// filePageSize returns the system page size on darwin.
+func filePageSize(file *os.File) int {
+	return os.Getpagesize()
+}
+
+// transparentHugePageSize returns zero since transparent huge pages aren't
+// available on darwin.
+func transparentHugePageSize() int {
+	return 0
+}
+
+// adviseHugePages is not supported on darwin.
+func adviseHugePages(data []byte, enable bool) error {
+	return errUnsupported
+}
@@ -0,0 +1,183 @@
+package mmap
+
+import (
+	"io"
+	"io/ioutil"
+	"math/bits"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// sendfile copies count bytes of file starting at offset to dst with the
+// sendfile system call. It reports false when dst is not a socket or pipe,
+// in which case nothing has been written.
+func sendfile(dst syscall.Conn, file *os.File, offset int64, count int) (int, bool, error) {
+	raw, err := dst.SyscallConn()
+	if err != nil {
+		return 0, false, nil
+	}
+
+	supported := false
+	err = raw.Control(func(fd uintptr) {
+		var stat unix.Stat_t
+		if unix.Fstat(int(fd), &stat) != nil {
+			return
+		}
+		mode := stat.Mode & unix.S_IFMT
+		supported = mode == unix.S_IFSOCK || mode == unix.S_IFIFO
+	})
+	if err != nil || !supported {
+		return 0, false, nil
+	}
+
+	var (
+		in      = int(file.Fd())
+		written int
+		serr    error
+	)
+
+	err = raw.Write(func(fd uintptr) bool {
+		for written < count {
+			n, e := unix.Sendfile(int(fd), in, &offset, count-written)
+			if n > 0 {
+				written += n
+			}
+			switch {
+			case e == unix.EAGAIN:
+				return false
+			case e == unix.EINTR:
+				continue
+			case e != nil:
+				serr = e
+				return true
+			case n == 0:
+				serr = io.ErrUnexpectedEOF
+				return true
+			}
+		}
+		return true
+	})
+	if serr == nil {
+		serr = err
+	}
+
+	if written == 0 && (serr == unix.EINVAL || serr == unix.ENOSYS) {
+		return 0, false, nil
+	}
+
+	return written, true, serr
+}
+
+// zeroRange zeroes a range of file with fallocate, keeping its blocks allocated.
+func zeroRange(file *os.File, offset int64, size int64) error {
+	return unix.Fallocate(int(file.Fd()), unix.FALLOC_FL_ZERO_RANGE|unix.FALLOC_FL_KEEP_SIZE, offset, size)
+}
+
+// punchHole deallocates a range of file, which then reads as zeros.
+func punchHole(file *os.File, offset int64, size int64) error {
+	return unix.Fallocate(int(file.Fd()), unix.FALLOC_FL_PUNCH_HOLE|unix.FALLOC_FL_KEEP_SIZE, offset, size)
+}
+
+// allocate reserves blocks for a range of file, extending it if necessary.
+func allocate(file *os.File, offset int64, size int64) error {
+	for {
+		err := unix.Fallocate(int(file.Fd()), 0, offset, size)
+		if err != unix.EINTR {
+			return err
+		}
+	}
+}
+
+// cloneFile makes dst share the blocks of src with the FICLONE ioctl, which
+// is supported by copy-on-write file systems such as Btrfs and XFS.
+func cloneFile(dst *os.File, src *os.File) error {
+	return unix.IoctlFileClone(int(dst.Fd()), int(src.Fd()))
+}
+
+// copyFileRange copies the first size bytes of src to dst within the kernel
+// with copy_file_range.
+func copyFileRange(dst *os.File, src *os.File, size int64) error {
+	var offset int64
+	for offset < size {
+		remaining := size - offset
+		if remaining > 1<<30 {
+			remaining = 1 << 30
+		}
+
+		n, err := unix.CopyFileRange(int(src.Fd()), &offset, int(dst.Fd()), nil, int(remaining), 0)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return io.ErrUnexpectedEOF
+		}
+	}
+	return nil
+}
+
+// fdatasync flushes the data of file and the metadata needed to read it.
+func fdatasync(file *os.File) error {
+	return unix.Fdatasync(int(file.Fd()))
+}
+
+// populate reads the pages of data into memory so later accesses don't fault.
+// Kernels older than 5.14 are only advised that the pages will be needed.
+func populate(data []byte) error {
+	err := unix.Madvise(data, unix.MADV_POPULATE_READ)
+	if err == unix.EINVAL {
+		err = unix.Madvise(data, unix.MADV_WILLNEED)
+	}
+	return err
+}
+
+// hugetlbFlags returns the mmap flags for memory from the hugetlb pool using
+// pages of the given size.
+func hugetlbFlags(size int) (int, error) {
+	if size <= 0 || size&(size-1) != 0 {
+		return 0, errEINVAL
+	}
+	return unix.MAP_HUGETLB | bits.TrailingZeros(uint(size))<<unix.MAP_HUGE_SHIFT, nil
+}
+
+// filePageSize returns the page size used by the file system of file, which is
+// the huge page size for files on hugetlbfs.
+func filePageSize(file *os.File) int {
+	var stat unix.Statfs_t
+	err := unix.Fstatfs(int(file.Fd()), &stat)
+	if err == nil && int64(stat.Type) == unix.HUGETLBFS_MAGIC && stat.Bsize > 0 {
+		return int(stat.Bsize)
+	}
+	return os.Getpagesize()
+}
+
+// transparentHugePageSize returns the size of transparent huge pages, or zero if
+// they aren't available.
+func transparentHugePageSize() int {
+	b, err := ioutil.ReadFile("/sys/kernel/mm/transparent_hugepage/hpage_pmd_size")
+	if err != nil {
+		return 0
+	}
+
+	size, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil || size <= os.Getpagesize() {
+		return 0
+	}
+
+	return size
+}
+
+// adviseHugePages enables or disables transparent huge pages for data.
+func adviseHugePages(data []byte, enable bool) error {
+	advice := unix.MADV_NOHUGEPAGE
+	if enable {
+		advice = unix.MADV_HUGEPAGE
+	}
+	return unix.Madvise(data, advice)
+}
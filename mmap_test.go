@@ -0,0 +1,29 @@
+package mmap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// tempMap opens a writeable map of size bytes in a new temporary directory.
+// Call the returned function to close the map and remove the directory.
+func tempMap(t *testing.T, size int, opts ...Option) (*Map, func()) {
+	dir, err := ioutil.TempDir("", "mmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts = append([]Option{WithCreate(), WithInitialSize(size)}, opts...)
+	m, err := OpenWith(filepath.Join(dir, "map"), opts...)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return m, func() {
+		m.Close()
+		os.RemoveAll(dir)
+	}
+}
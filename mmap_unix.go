@@ -3,6 +3,7 @@
 package mmap
 
 import (
+	"os"
 	"unsafe"
 
 	"golang.org/x/sys/unix"
@@ -12,6 +13,9 @@ var (
 	errEAGAIN error = unix.EAGAIN
 	errEINVAL error = unix.EINVAL
 	errENOENT error = unix.ENOENT
+	errENXIO  error = unix.ENXIO
+
+	errUnsupported error = unix.ENOTSUP
 )
 
 func errnoErr(e unix.Errno) error {
@@ -24,31 +28,154 @@ func errnoErr(e unix.Errno) error {
 		return errEINVAL
 	case unix.ENOENT:
 		return errENOENT
+	case unix.ENXIO:
+		return errENXIO
 	default:
 		return e
 	}
 }
 
 func mmap(fd uintptr, size int, write bool) ([]byte, error) {
-	if size <= 0 {
-		return nil, errEINVAL
+	return mmapAt(0, fd, size, write, unix.MAP_SHARED)
+}
+
+// mmapFile maps size bytes of fd. If align is greater than the system page size,
+// the mapping is placed at an address that is a multiple of it.
+func mmapFile(fd uintptr, size int, write bool, align int) ([]byte, error) {
+	if align > os.Getpagesize() {
+		return mmapAligned(fd, size, write, unix.MAP_SHARED, align)
+	}
+	return mmap(fd, size, write)
+}
+
+// mmapAnon creates size bytes of anonymous shared memory. If huge is not zero,
+// the memory comes from the hugetlb pool using pages of that size. The align
+// argument is the same as for mmapFile.
+func mmapAnon(size int, huge int, align int) ([]byte, error) {
+	flags := unix.MAP_SHARED | unix.MAP_ANON
+	if huge != 0 {
+		hflags, err := hugetlbFlags(huge)
+		if err != nil {
+			return nil, err
+		}
+		flags = flags | hflags
 	}
 
-	var (
-		prot = unix.PROT_READ
-		flag = unix.MAP_SHARED
-	)
+	if align > os.Getpagesize() {
+		return mmapAligned(^uintptr(0), size, true, flags, align)
+	}
+	return mmapAt(0, ^uintptr(0), size, true, flags)
+}
 
+// mmapAt maps size bytes of fd with the given flags. The address is a hint
+// unless flags include MAP_FIXED, in which case the mapping replaces whatever
+// is mapped at addr.
+func mmapAt(addr uintptr, fd uintptr, size int, write bool, flags int) ([]byte, error) {
+	prot := unix.PROT_READ
 	if write {
 		prot = prot | unix.PROT_WRITE
 	}
+	return mmapProt(addr, fd, size, prot, flags)
+}
+
+// mmapPrivate creates a private copy-on-write mapping of size bytes of fd.
+func mmapPrivate(fd uintptr, size int) ([]byte, error) {
+	return mmapAt(0, fd, size, true, unix.MAP_PRIVATE)
+}
+
+// mmapFixed maps size bytes of fd at addr, replacing whatever is mapped there.
+func mmapFixed(addr uintptr, fd uintptr, size int, write bool) ([]byte, error) {
+	return mmapAt(addr, fd, size, write, unix.MAP_SHARED|unix.MAP_FIXED)
+}
+
+// mmapAnonFixed creates size bytes of anonymous shared memory at addr, replacing
+// whatever is mapped there. The huge argument is the same as for mmapAnon.
+func mmapAnonFixed(addr uintptr, size int, huge int) ([]byte, error) {
+	flags := unix.MAP_SHARED | unix.MAP_ANON | unix.MAP_FIXED
+	if huge != 0 {
+		hflags, err := hugetlbFlags(huge)
+		if err != nil {
+			return nil, err
+		}
+		flags = flags | hflags
+	}
+	return mmapAt(addr, ^uintptr(0), size, true, flags)
+}
+
+// reserve reserves size bytes of address space that can't be accessed until
+// something is mapped into it with mmapAt.
+func reserve(size int) ([]byte, error) {
+	return reserveAt(0, size)
+}
+
+// reserveAt is like reserve, but if addr is not zero the reservation replaces
+// whatever is mapped at addr.
+func reserveAt(addr uintptr, size int) ([]byte, error) {
+	flags := unix.MAP_PRIVATE | unix.MAP_ANON | unix.MAP_NORESERVE
+	if addr != 0 {
+		flags = flags | unix.MAP_FIXED
+	}
+	return mmapProt(addr, ^uintptr(0), size, unix.PROT_NONE, flags)
+}
+
+// reserveAligned reserves size bytes of address space starting at a multiple
+// of align.
+func reserveAligned(size int, align int) ([]byte, error) {
+	if size <= 0 || align <= 0 {
+		return nil, errEINVAL
+	}
+
+	region, err := reserve(size + align)
+	if err != nil {
+		return nil, err
+	}
+
+	base := uintptr(unsafe.Pointer(&region[0]))
+	start := int((base+uintptr(align)-1)&^uintptr(align-1) - base)
+	end := start + size
+
+	if start > 0 {
+		munmap(region[:start:start])
+	}
+	if end < len(region) {
+		munmap(region[end:])
+	}
 
-	r0, _, e1 := unix.Syscall6(unix.SYS_MMAP, 0, uintptr(size), uintptr(prot), uintptr(flag), fd, 0)
+	return region[start:end:end], nil
+}
+
+// mmapAligned maps size bytes of fd at an address that is a multiple of align.
+func mmapAligned(fd uintptr, size int, write bool, flags int, align int) ([]byte, error) {
+	region, err := reserveAligned(size, align)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := mmapAt(dataAddr(region), fd, size, write, flags|unix.MAP_FIXED)
+	if err != nil {
+		munmap(region)
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// dataAddr returns the address of the start of data.
+func dataAddr(data []byte) uintptr {
+	return uintptr(unsafe.Pointer(&data[0]))
+}
+
+func mmapProt(addr uintptr, fd uintptr, size int, prot int, flags int) ([]byte, error) {
+	if size <= 0 {
+		return nil, errEINVAL
+	}
+
+	r0, _, e1 := unix.Syscall6(unix.SYS_MMAP, addr, uintptr(size), uintptr(prot), uintptr(flags), fd, 0)
 	if e1 != 0 {
 		return nil, errnoErr(e1)
 	}
 
-	addr := uintptr(r0)
+	addr = uintptr(r0)
 
 	slice := struct {
 		addr uintptr
@@ -86,3 +213,60 @@ func msync(data []byte, wait bool) error {
 	}
 	return unix.Msync(data, flags)
 }
+
+// seekData returns the offset of the first data at or after offset in file.
+// It returns errENXIO if there is no data after offset.
+func seekData(file *os.File, offset int64) (int64, error) {
+	return seek(file, offset, unix.SEEK_DATA)
+}
+
+// seekHole returns the offset of the first hole at or after offset in file.
+// The end of the file counts as a hole.
+func seekHole(file *os.File, offset int64) (int64, error) {
+	return seek(file, offset, unix.SEEK_HOLE)
+}
+
+func seek(file *os.File, offset int64, whence int) (int64, error) {
+	pos, err := unix.Seek(int(file.Fd()), offset, whence)
+	if e, ok := err.(unix.Errno); ok {
+		return 0, errnoErr(e)
+	}
+	return pos, err
+}
+
+// pageFaults returns the number of minor and major page faults of the process.
+func pageFaults() (minor int64, major int64) {
+	var usage unix.Rusage
+	if unix.Getrusage(unix.RUSAGE_SELF, &usage) != nil {
+		return 0, 0
+	}
+	return int64(usage.Minflt), int64(usage.Majflt)
+}
+
+// madvise gives the kernel advice about how data will be accessed.
+func madvise(data []byte, advice Advice) error {
+	flags := unix.MADV_NORMAL
+	switch advice {
+	case AdviceRandom:
+		flags = unix.MADV_RANDOM
+	case AdviceSequential:
+		flags = unix.MADV_SEQUENTIAL
+	case AdviceWillNeed:
+		flags = unix.MADV_WILLNEED
+	case AdviceDontNeed:
+		flags = unix.MADV_DONTNEED
+	}
+	return unix.Madvise(data, flags)
+}
+
+// mprotect sets the protection of the pages containing data.
+func mprotect(data []byte, prot Protection) error {
+	flags := unix.PROT_NONE
+	switch prot {
+	case ProtectRead:
+		flags = unix.PROT_READ
+	case ProtectReadWrite:
+		flags = unix.PROT_READ | unix.PROT_WRITE
+	}
+	return unix.Mprotect(data, flags)
+}
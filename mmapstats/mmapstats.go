@@ -0,0 +1,27 @@
+// Package mmapstats exports the statistics of memory maps with expvar.
+//
+// It is kept separate from package mmap so that using mmap doesn't register
+// the expvar HTTP handler.
+package mmapstats
+
+import (
+	"expvar"
+
+	"github.com/go-util/mmap"
+)
+
+// Var returns an expvar.Var that reports the current Stats of m as JSON. It
+// enables lock wait timing on m with SetLockStats.
+func Var(m *mmap.Map) expvar.Var {
+	m.SetLockStats(true)
+
+	return expvar.Func(func() interface{} {
+		return m.Stats()
+	})
+}
+
+// Publish publishes the Stats of m under name with expvar. Like
+// expvar.Publish, it panics if name is already registered.
+func Publish(name string, m *mmap.Map) {
+	expvar.Publish(name, Var(m))
+}
@@ -0,0 +1,31 @@
+package mmapstats
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+
+	"github.com/go-util/mmap"
+)
+
+func TestPublish(t *testing.T) {
+	m, err := mmap.Anonymous(100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	w, _ := m.Writer()
+	w.WriteString("hello")
+
+	Publish("mmapstats_test", m)
+
+	var s mmap.Stats
+	err = json.Unmarshal([]byte(expvar.Get("mmapstats_test").String()), &s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Writers != 1 || s.BytesWritten != 5 {
+		t.Fatalf("published %+v, want 1 writer and 5 bytes written", s)
+	}
+}
@@ -0,0 +1,20 @@
+package mmap
+
+// notifier is not supported on darwin.
+type notifier struct{}
+
+// newNotifier is not supported on darwin.
+func newNotifier(dir string) (*notifier, error) {
+	return nil, errUnsupported
+}
+
+func (n *notifier) wait() ([]string, error) {
+	return nil, nil
+}
+
+func (n *notifier) stop() {
+}
+
+func (n *notifier) close() error {
+	return nil
+}
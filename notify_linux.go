@@ -0,0 +1,102 @@
+package mmap
+
+import (
+	"bytes"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// notifier reports changes to the files in a directory using inotify.
+type notifier struct {
+	fd   int
+	wake [2]int
+	buf  [64 * 1024]byte
+}
+
+// newNotifier watches dir for files that are created, modified or moved into it.
+func newNotifier(dir string) (*notifier, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+
+	mask := uint32(unix.IN_CREATE | unix.IN_MODIFY | unix.IN_CLOSE_WRITE |
+		unix.IN_MOVED_TO | unix.IN_ATTRIB)
+	_, err = unix.InotifyAddWatch(fd, dir, mask)
+	if err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	n := &notifier{fd: fd}
+
+	err = unix.Pipe2(n.wake[:], unix.O_CLOEXEC|unix.O_NONBLOCK)
+	if err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	return n, nil
+}
+
+// wait blocks until files in the directory change and returns their names. It
+// returns nil without an error once stop is called.
+func (n *notifier) wait() ([]string, error) {
+	fds := []unix.PollFd{
+		{Fd: int32(n.fd), Events: unix.POLLIN},
+		{Fd: int32(n.wake[0]), Events: unix.POLLIN},
+	}
+
+	for {
+		_, err := unix.Poll(fds, -1)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if fds[1].Revents != 0 {
+			return nil, nil
+		}
+
+		size, err := unix.Read(n.fd, n.buf[:])
+		if err == unix.EAGAIN || err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var names []string
+		for offset := 0; offset+unix.SizeofInotifyEvent <= size; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&n.buf[offset]))
+			offset += unix.SizeofInotifyEvent
+
+			name := n.buf[offset : offset+int(event.Len)]
+			offset += int(event.Len)
+
+			if i := bytes.IndexByte(name, 0); i >= 0 {
+				name = name[:i]
+			}
+			names = append(names, string(name))
+		}
+
+		if len(names) > 0 {
+			return names, nil
+		}
+	}
+}
+
+// stop makes wait return. It may be called concurrently with wait.
+func (n *notifier) stop() {
+	unix.Write(n.wake[1], []byte{0})
+}
+
+// close releases the notifier. Call it after wait has returned.
+func (n *notifier) close() error {
+	unix.Close(n.wake[0])
+	unix.Close(n.wake[1])
+	return unix.Close(n.fd)
+}
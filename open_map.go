@@ -7,8 +7,40 @@ import (
 // Open opens a file as a memory map using the given flags. It does not support the O_WRONLY or
 // O_APPEND flags. It will create the file if it doesn't exist. If the file is empty or
 // O_TRUNC is specified, the file will be resized to the size of a memory page as
-// returned by os.Getpagesize() and the bytes will be zeroed out.
+// returned by os.Getpagesize() and the bytes will be zeroed out. Files on hugetlbfs are
+// resized to the size of a huge page instead.
 func Open(name string, flags int, mode os.FileMode) (*Map, error) {
+	return OpenWith(name, WithFlags(flags), WithMode(mode))
+}
+
+// OpenWith opens a file as a memory map configured by opts. Without options, an
+// existing file is opened read-write with the same behaviour as Open.
+func OpenWith(name string, opts ...Option) (*Map, error) {
+	o := newOptions(opts)
+	m, err := open(name, o)
+	return opened(name, o, m, err)
+}
+
+// opened calls the Open or Error hook for a map that was opened with o.
+func opened(name string, o *options, m *Map, err error) (*Map, error) {
+	if err != nil {
+		if o.hooks != nil && o.hooks.Error != nil {
+			o.hooks.Error(name, "open", err)
+		}
+		return nil, err
+	}
+
+	m.hooks = o.hooks
+	if o.hooks != nil && o.hooks.Open != nil {
+		o.hooks.Open(name, len(m.data))
+	}
+
+	return m, nil
+}
+
+func open(name string, o *options) (*Map, error) {
+	flags := o.flags
+
 	switch {
 	case isSet(flags, os.O_WRONLY):
 		return nil, errors.New("Map does not support O_WRONLY flag").
@@ -22,7 +54,7 @@ func Open(name string, flags int, mode os.FileMode) (*Map, error) {
 		write = isSet(flags, ReadWrite)
 		creat = isSet(flags, Create)
 		excl  = isSet(flags, Exclusive)
-		wsync = isSet(flags, Sync)
+		wsync = o.wsync()
 		trunc = isSet(flags, Truncate)
 	)
 
@@ -39,15 +71,50 @@ func Open(name string, flags int, mode os.FileMode) (*Map, error) {
 	case trunc && !write:
 		return nil, errors.New("O_TRUNC requires O_RDWR flag").
 			Set("name", name).Set("flags", flags)
+	case o.initial < 0:
+		return nil, errors.New("initial size must not be negative").
+			Set("name", name).Set("size", o.initial)
+	case o.minimum < 0:
+		return nil, errors.New("minimum size must not be negative").
+			Set("name", name).Set("size", o.minimum)
+	case o.minimum > 0 && !write:
+		return nil, errors.New("minimum size requires O_RDWR flag").
+			Set("name", name).Set("flags", flags)
 	}
 
-	file, err := os.OpenFile(name, flags, mode)
+	file, err := os.OpenFile(name, flags, o.mode)
 	if err != nil {
 		err = errors.Wrap(err, "could not open file").Set("name", name)
 		return nil, err
 	}
-	defer file.Close()
 
+	m, err := openFile(file, name, write, trunc, o)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	m.wsync = wsync
+
+	err = m.configure(o)
+	if err != nil {
+		m.closeMap()
+		return nil, err
+	}
+
+	if m.durable && write {
+		err = m.syncFile(creat)
+		if err != nil {
+			m.closeMap()
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// openFile maps an open file. The file is retained by the returned Map and
+// closed with it.
+func openFile(file *os.File, name string, write bool, trunc bool, o *options) (*Map, error) {
 	info, err := file.Stat()
 	if err != nil {
 		err = errors.Wrap(err, "could not stat file").Set("name", name)
@@ -58,12 +125,39 @@ func Open(name string, flags int, mode os.FileMode) (*Map, error) {
 		return nil, errors.New("cannot mmap empty file").Set("name", name)
 	}
 
-	if write && (info.Size() < 1 || trunc) {
-		size := int64(os.Getpagesize())
+	page := filePageSize(file)
+
+	if write && (info.Size() < 1 || trunc || info.Size() < int64(o.minimum)) {
+		size := info.Size()
+		if size < 1 || trunc {
+			size = int64(page)
+			if o.initial > 0 {
+				size = int64(o.initial)
+			}
+		}
+		if size < int64(o.minimum) {
+			size = int64(o.minimum)
+		}
+		if page > os.Getpagesize() {
+			size = (size + int64(page) - 1) / int64(page) * int64(page)
+		}
+
+		if o.prealloc && size > info.Size() {
+			err = preallocate(file, info.Size(), size-info.Size())
+			if err != nil {
+				file.Truncate(info.Size())
+				return nil, errors.Wrap(err, "could not allocate space for file").
+					Set("name", name).Set("size", size)
+			}
+		}
+
 		err = file.Truncate(size)
 		if err != nil {
-			if trunc {
+			switch {
+			case trunc:
 				return nil, errors.New("could not truncate file").Set("name", name)
+			case info.Size() > 0:
+				return nil, errors.New("could not grow file to minimum size").Set("name", name)
 			}
 			return nil, errors.New("could not resize new or empty file").Set("name", name)
 		}
@@ -95,17 +189,49 @@ func Open(name string, flags int, mode os.FileMode) (*Map, error) {
 		}
 		err := msync(data, true)
 		if err != nil {
+			munmap(data)
 			return nil, errors.Wrap(err, "error syncing mmap after truncate")
 		}
 	}
 
-	return &Map{
-		name:    name,
+	m := &Map{
+		file:    file,
 		data:    data,
 		write:   write,
-		wsync:   wsync,
+		falloc:  o.prealloc,
+		durable: o.durable,
+		page:    page,
+		stats:   newStats(),
 		direct:  make(map[uintptr]Direct),
 		readers: make(map[int]*Reader),
 		writers: make(map[int]*Writer),
-	}, nil
+	}
+	m.name.Store(name)
+
+	return m, nil
+}
+
+// configure applies the options that take effect once the file is mapped.
+// The map must not be shared yet.
+func (m *Map) configure(o *options) error {
+	m.grow = o.grow
+	m.SetLockStats(o.timeLock)
+	m.advice = o.advice
+	m.preload = o.populate
+
+	if o.huge {
+		err := m.SetHugePages(true)
+		if err != nil {
+			return err
+		}
+	}
+
+	if o.reserve > 0 {
+		err := m.Reserve(o.reserve)
+		if err != nil {
+			return err
+		}
+	}
+
+	return m.remapped()
 }
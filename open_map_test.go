@@ -0,0 +1,66 @@
+package mmap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInitialSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "map")
+	tests := []struct {
+		opts []Option
+		size int
+	}{
+		// A new file is created with the initial size, or a page by default.
+		{[]Option{WithCreate(), WithInitialSize(10000)}, 10000},
+		// The initial size doesn't apply to a file that isn't empty.
+		{[]Option{WithInitialSize(5000)}, 10000},
+		// Unless it is truncated.
+		{[]Option{WithTruncate(), WithInitialSize(5000)}, 5000},
+		{[]Option{WithTruncate()}, os.Getpagesize()},
+		// A file is grown to the minimum size, but never shrunk.
+		{[]Option{WithMinSize(20000), WithPreallocate()}, 20000},
+		{[]Option{WithMinSize(100)}, 20000},
+		{[]Option{WithTruncate(), WithInitialSize(100), WithMinSize(200)}, 200},
+	}
+	for i, test := range tests {
+		m, err := OpenWith(name, test.opts...)
+		if err != nil {
+			t.Fatalf("open %d: %v", i, err)
+		}
+		size := m.Size()
+		m.Close()
+
+		info, _ := os.Stat(name)
+		if size != test.size || info.Size() != int64(test.size) {
+			t.Fatalf("open %d mapped %d bytes of a %d byte file, want %d", i, size, info.Size(), test.size)
+		}
+	}
+
+	// The initial size is zeroed when the file is truncated.
+	m, _ := OpenWith(name)
+	w, _ := m.Writer()
+	w.WriteString("hello")
+	m.Close()
+	m, _ = OpenWith(name, WithTruncate(), WithInitialSize(10))
+	r, _ := m.Reader()
+	if eq, _ := r.Equal(0, make([]byte, 10)); !eq {
+		t.Fatal("truncated file wasn't zeroed")
+	}
+	m.Close()
+
+	if _, err := OpenWith(name, WithInitialSize(-1)); err == nil {
+		t.Fatal("OpenWith accepted a negative initial size")
+	}
+	if _, err := OpenWith(name, WithReadOnly(), WithMinSize(1)); err == nil {
+		t.Fatal("OpenWith grew a read-only file")
+	}
+}
@@ -0,0 +1,250 @@
+package mmap
+
+import (
+	"os"
+)
+
+// Advice tells the kernel how a map will be accessed, so it can choose
+// appropriate read-ahead and caching.
+type Advice int
+
+// Kinds of advice for WithAdvice and Map.Advise.
+const (
+	AdviceNormal     Advice = iota // no special treatment
+	AdviceRandom                   // expect access in random order
+	AdviceSequential               // expect access in sequential order
+	AdviceWillNeed                 // expect access soon
+	AdviceDontNeed                 // don't expect access soon
+)
+
+// SyncPolicy controls when changes made through Writers are flushed to the
+// backing file.
+type SyncPolicy int
+
+// Sync policies for WithSyncPolicy.
+const (
+	SyncManual  SyncPolicy = iota // flushed by Sync, Close or the kernel
+	SyncOnWrite                   // flushed after every write, like the Sync flag
+)
+
+// Option configures a map opened with OpenWith.
+type Option func(*options)
+
+type options struct {
+	flags    int
+	mode     os.FileMode
+	initial  int
+	minimum  int
+	advice   Advice
+	populate bool
+	sync     SyncPolicy
+	grow     bool
+	prealloc bool
+	huge     bool
+	reserve  int
+	hooks    *Hooks
+	durable  bool
+	timeLock bool
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		flags: ReadWrite,
+		mode:  0600,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// wsync indicates if writes must be synced immediately.
+func (o *options) wsync() bool {
+	return isSet(o.flags, Sync) || o.sync == SyncOnWrite
+}
+
+// WithFlags sets the flags used to open the file, as for Open. This replaces any
+// flags set by other options.
+func WithFlags(flags int) Option {
+	return func(o *options) {
+		o.flags = flags
+	}
+}
+
+// WithReadOnly opens the map read-only instead of read-write.
+func WithReadOnly() Option {
+	return func(o *options) {
+		o.flags = o.flags&^(ReadOnly|ReadWrite) | ReadOnly
+	}
+}
+
+// WithCreate creates the file if it doesn't exist.
+func WithCreate() Option {
+	return func(o *options) {
+		o.flags = o.flags | Create
+	}
+}
+
+// WithExclusive creates the file and fails if it already exists.
+func WithExclusive() Option {
+	return func(o *options) {
+		o.flags = o.flags | Create | Exclusive
+	}
+}
+
+// WithTruncate resizes the file to its initial size and zeroes it when opened.
+func WithTruncate() Option {
+	return func(o *options) {
+		o.flags = o.flags | Truncate
+	}
+}
+
+// WithMode sets the file mode used when creating the file. The default is 0600.
+func WithMode(mode os.FileMode) Option {
+	return func(o *options) {
+		o.mode = mode
+	}
+}
+
+// WithInitialSize sets the size that new or empty files, and files opened with
+// WithTruncate, are resized to before they are mapped, so a large file is
+// created and mapped once instead of being truncated after opening. The default
+// is the size of a memory page. Files on hugetlbfs are rounded up to a multiple
+// of the huge page size.
+func WithInitialSize(size int) Option {
+	return func(o *options) {
+		o.initial = size
+	}
+}
+
+// WithMinSize grows existing files smaller than size to size before they are
+// mapped. New or empty files are also created with at least size bytes. The
+// extended part of the file reads as zeros. It requires a writeable map.
+func WithMinSize(size int) Option {
+	return func(o *options) {
+		o.minimum = size
+	}
+}
+
+// WithAdvice advises the kernel how the map will be accessed. The advice is
+// applied again whenever the map is resized.
+func WithAdvice(advice Advice) Option {
+	return func(o *options) {
+		o.advice = advice
+	}
+}
+
+// WithPopulate reads the whole file into memory when it is mapped, so later
+// accesses don't cause page faults.
+func WithPopulate() Option {
+	return func(o *options) {
+		o.populate = true
+	}
+}
+
+// WithSyncPolicy sets when changes made through Writers are flushed.
+func WithSyncPolicy(policy SyncPolicy) Option {
+	return func(o *options) {
+		o.sync = policy
+	}
+}
+
+// WithGrow lets Writer.ReadFrom extend the map. See Map.SetGrow.
+func WithGrow() Option {
+	return func(o *options) {
+		o.grow = true
+	}
+}
+
+// WithPreallocate allocates disk space before the map is extended, including
+// when a new or empty file is resized to its initial size. See Map.SetPreallocate.
+func WithPreallocate() Option {
+	return func(o *options) {
+		o.prealloc = true
+	}
+}
+
+// WithHugePages requests transparent huge pages. See Map.SetHugePages.
+func WithHugePages() Option {
+	return func(o *options) {
+		o.huge = true
+	}
+}
+
+// WithReserve reserves size bytes of address space for the map. See Map.Reserve.
+func WithReserve(size int) Option {
+	return func(o *options) {
+		o.reserve = size
+	}
+}
+
+// WithDurable makes changes to the map survive a crash once they are reported as
+// complete. Close flushes the map and the backing file to disk before returning,
+// and creating, publishing or resizing the file also syncs its directory. Errors
+// from flushing are returned by Close.
+func WithDurable() Option {
+	return func(o *options) {
+		o.durable = true
+	}
+}
+
+// WithLockStats measures how long the map waits to be locked. See Map.SetLockStats.
+func WithLockStats() Option {
+	return func(o *options) {
+		o.timeLock = true
+	}
+}
+
+// WithHooks sets callbacks for events in the lifecycle of the map.
+func WithHooks(hooks *Hooks) Option {
+	return func(o *options) {
+		o.hooks = hooks
+	}
+}
+
+// Advise advises the kernel how the map will be accessed. The advice is
+// applied again whenever the map is resized.
+func (m *Map) Advise(advice Advice) error {
+	m.lock()
+	defer m.Unlock()
+
+	if m.data == nil {
+		return errors.New("mmap closed").Set("name", m.Name())
+	}
+
+	m.advice = advice
+
+	err := madvise(m.data, advice)
+	if err != nil {
+		return errors.Wrap(err, "could not advise kernel").Set("name", m.Name()).
+			Set("advice", advice)
+	}
+
+	return nil
+}
+
+// remapped restores the settings of the map after it is mapped again.
+// Lock the map before calling.
+func (m *Map) remapped() error {
+	err := m.reprotect()
+	if err != nil {
+		return err
+	}
+
+	if m.advice != AdviceNormal {
+		err = madvise(m.data, m.advice)
+		if err != nil {
+			return errors.Wrap(err, "could not advise kernel").Set("name", m.Name()).
+				Set("advice", m.advice)
+		}
+	}
+
+	if m.preload {
+		err = populate(m.data)
+		if err != nil {
+			return errors.Wrap(err, "could not populate map").Set("name", m.Name())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package mmap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestOptionFlags(t *testing.T) {
+	tests := []struct {
+		opts  []Option
+		flags int
+	}{
+		{nil, ReadWrite},
+		{[]Option{WithReadOnly()}, ReadOnly},
+		{[]Option{WithCreate(), WithTruncate()}, ReadWrite | Create | Truncate},
+		{[]Option{WithExclusive()}, ReadWrite | Create | Exclusive},
+		{[]Option{WithCreate(), WithFlags(ReadOnly)}, ReadOnly},
+		{[]Option{WithFlags(ReadOnly | Create), WithReadOnly()}, ReadOnly | Create},
+	}
+	for i, test := range tests {
+		if flags := newOptions(test.opts).flags; flags != test.flags {
+			t.Errorf("options %d set flags %#x, want %#x", i, flags, test.flags)
+		}
+	}
+}
+
+func TestOpenWith(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "map")
+	if _, err := OpenWith(name); err == nil {
+		t.Fatal("OpenWith created a file without WithCreate")
+	}
+
+	m, err := OpenWith(name, WithExclusive(), WithMode(0640), WithGrow(), WithLockStats(),
+		WithSyncPolicy(SyncOnWrite), WithReserve(1<<20), WithAdvice(AdviceSequential), WithPopulate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Writeable() || !m.Grow() || !m.wsync || m.Reserved() != 1<<20 || m.advice != AdviceSequential || !m.preload {
+		t.Fatal("OpenWith didn't apply the options")
+	}
+	if atomic.LoadInt32(&m.stats.timeLock) == 0 {
+		t.Fatal("WithLockStats didn't enable lock timing")
+	}
+	m.Close()
+
+	if info, _ := os.Stat(name); info.Mode().Perm() != 0640 {
+		t.Fatalf("file created with mode %v, want %v", info.Mode().Perm(), os.FileMode(0640))
+	}
+
+	if _, err := OpenWith(name, WithExclusive()); err == nil {
+		t.Fatal("WithExclusive opened an existing file")
+	}
+	if _, err := OpenWith(name, WithReadOnly(), WithCreate()); err == nil {
+		t.Fatal("OpenWith created a read-only file")
+	}
+
+	m, err = OpenWith(name, WithReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if m.Writeable() {
+		t.Fatal("WithReadOnly opened a writeable map")
+	}
+	if _, err := m.Writer(); err == nil {
+		t.Fatal("Writer on a read-only map succeeded")
+	}
+}
@@ -0,0 +1,150 @@
+package mmap
+
+import (
+	"bytes"
+	"context"
+	"sync"
+)
+
+// BoundaryFunc adjusts the end of a chunk for ParallelScan. It is given the
+// entire map and the proposed end offset of a chunk and returns the offset at
+// which the chunk should actually end, such as just past the next record marker.
+// The returned offset must be past the start of the chunk and may be len(data).
+type BoundaryFunc func(data []byte, end int) int
+
+// Delimiter returns a BoundaryFunc that ends each chunk just after the next
+// occurrence of delim, or at the end of the map if there is none.
+func Delimiter(delim byte) BoundaryFunc {
+	return func(data []byte, end int) int {
+		i := bytes.IndexByte(data[end:], delim)
+		if i < 0 {
+			return len(data)
+		}
+		return end + i + 1
+	}
+}
+
+// ScanFunc processes a chunk of the map for ParallelScan. The chunk points
+// directly into the map and must not be modified or used after ScanFunc returns.
+type ScanFunc func(ctx context.Context, offset int, chunk []byte) error
+
+// ParallelScan splits the map into chunks of about chunkSize bytes and calls fn on
+// them from the given number of goroutines. If boundary is not nil, it is used to
+// move the end of each chunk to a suitable boundary.
+//
+// ParallelScan stops when ctx is cancelled or fn returns an error, and returns
+// the first error encountered. While it runs, the map holds a read lease like
+// Borrow, so Truncate, Close and anything else that would unmap or protect the
+// memory being scanned fails instead. Writers are not blocked, so fn may see
+// writes made during the scan.
+func (m *Map) ParallelScan(ctx context.Context, workers int, chunkSize int, boundary BoundaryFunc, fn ScanFunc) error {
+	if workers < 1 {
+		return errors.New("workers must be greater than zero").Set("name", m.Name()).
+			Set("workers", workers)
+	}
+
+	if chunkSize < 1 {
+		return errors.New("chunk size must be greater than zero").Set("name", m.Name()).
+			Set("chunk_size", chunkSize)
+	}
+
+	data, err := m.leaseAll()
+	if err != nil {
+		return err
+	}
+	defer m.unleaseAll()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+		chunks   = make(chan [2]int)
+	)
+
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range chunks {
+				err := fn(ctx, c[0], data[c[0]:c[1]:c[1]])
+				if err != nil {
+					fail(err)
+				}
+			}
+		}()
+	}
+
+	err = splitChunks(ctx, data, chunkSize, boundary, chunks)
+	close(chunks)
+	wg.Wait()
+
+	if err != nil {
+		fail(errors.Wrap(err, "parallel scan error").Set("name", m.Name()))
+	}
+
+	return firstErr
+}
+
+// leaseAll returns the whole map and takes a lease on it like Borrow.
+func (m *Map) leaseAll() ([]byte, error) {
+	m.lock()
+	defer m.Unlock()
+
+	if m.data == nil {
+		return nil, errors.New("mmap closed").Set("name", m.Name())
+	}
+
+	err := m.checkProtect(0, len(m.data), false)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot scan protected map").Set("name", m.Name())
+	}
+
+	m.leases++
+	return m.data, nil
+}
+
+// unleaseAll releases a lease taken with leaseAll.
+func (m *Map) unleaseAll() {
+	m.lock()
+	defer m.Unlock()
+
+	m.leases--
+}
+
+// splitChunks sends the start and end of each chunk of data to chunks until
+// all of data is covered or ctx is done.
+func splitChunks(ctx context.Context, data []byte, chunkSize int, boundary BoundaryFunc, chunks chan<- [2]int) error {
+	for start := 0; start < len(data); {
+		end := start + chunkSize
+		if end < start || end >= len(data) {
+			end = len(data)
+		} else if boundary != nil {
+			proposed := end
+			end = boundary(data, proposed)
+			if end <= start || len(data) < end {
+				return errors.New("boundary function returned invalid offset").
+					Set("start", start).Set("proposed_end", proposed).Set("end", end)
+			}
+		}
+
+		select {
+		case chunks <- [2]int{start, end}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		start = end
+	}
+
+	return nil
+}
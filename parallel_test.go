@@ -0,0 +1,54 @@
+package mmap
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"testing"
+)
+
+func TestParallelScan(t *testing.T) {
+	m, done := tempMap(t, 100000)
+	defer done()
+
+	w, _ := m.Writer()
+	w.Write(bytes.Repeat([]byte("abcdefghi\n"), 10000))
+
+	var (
+		mu    sync.Mutex
+		lines int
+	)
+	err := m.ParallelScan(context.Background(), 4, 1000, Delimiter('\n'), func(ctx context.Context, offset int, chunk []byte) error {
+		if chunk[len(chunk)-1] != '\n' {
+			t.Errorf("chunk at %d doesn't end at a delimiter", offset)
+		}
+
+		// The map is leased, not locked, so it can be written but not truncated.
+		if _, err := w.WriteAt(chunk[:1], int64(offset)); err != nil {
+			t.Error(err)
+		}
+		if err := m.Truncate(10); err == nil {
+			t.Error("map truncated during scan")
+		}
+
+		mu.Lock()
+		lines += bytes.Count(chunk, []byte("\n"))
+		mu.Unlock()
+		return nil
+	})
+	if err != nil || lines != 10000 {
+		t.Fatalf("ParallelScan returned %v after %d lines, want nil after 10000", err, lines)
+	}
+
+	err = m.ParallelScan(context.Background(), 4, 10, nil, func(ctx context.Context, offset int, chunk []byte) error {
+		return io.ErrClosedPipe
+	})
+	if err != io.ErrClosedPipe {
+		t.Fatalf("ParallelScan returned %v, want %v", err, io.ErrClosedPipe)
+	}
+
+	if err := m.Truncate(10); err != nil {
+		t.Fatal("ParallelScan didn't release its lease:", err)
+	}
+}
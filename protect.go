@@ -0,0 +1,239 @@
+package mmap
+
+// Protection is the access allowed to a region of a map set with Protect.
+type Protection int
+
+// Protections that can be set with Protect.
+const (
+	ProtectNone      Protection = iota // the region can't be accessed
+	ProtectRead                        // the region can only be read
+	ProtectReadWrite                   // the region can be read and written
+)
+
+// protection is a protected region of a map.
+type protection struct {
+	offset int
+	size   int
+	prot   Protection
+}
+
+// Protect changes the access allowed to a region of the map. The offset must
+// be a multiple of the map's page size and the size is rounded up to one.
+// Readers, Writers, iterators and ParallelScan return an error instead of
+// accessing a protected region. Accessing a protected region through a Direct
+// slice raises a fault. Since slices borrowed from the map, and the parts used
+// by WriteTo, ReadFrom and ParallelScan, aren't checked again, a region can only
+// be made unreadable or read-only while there are none.
+//
+// Protections are kept when the map is resized. Setting ProtectReadWrite
+// removes the protection from a region.
+func (m *Map) Protect(offset int, size int, prot Protection) error {
+	if prot < ProtectNone || prot > ProtectReadWrite {
+		return errors.New("invalid protection").Set("name", m.Name()).Set("prot", prot)
+	}
+
+	m.lock()
+	defer m.Unlock()
+
+	if m.data == nil {
+		return errors.New("mmap closed").Set("name", m.Name())
+	}
+
+	if !m.write && prot == ProtectReadWrite {
+		return errors.New("cannot make read-only map writeable").Set("name", m.Name())
+	}
+
+	if prot != ProtectReadWrite {
+		err := m.checkLeases()
+		if err != nil {
+			return errors.Wrap(err, "cannot protect region").Set("name", m.Name())
+		}
+	}
+
+	if offset%m.page != 0 {
+		return errors.New("offset must be a multiple of the page size").Set("name", m.Name()).
+			Set("offset", offset).Set("page_size", m.page)
+	}
+
+	err := m.checkRegion(offset, size)
+	if err != nil {
+		return err
+	}
+
+	size = (size + m.page - 1) / m.page * m.page
+	if offset+size > len(m.data) {
+		size = len(m.data) - offset
+	}
+
+	err = mprotect(m.data[offset:offset+size], prot)
+	if err != nil {
+		return errors.Wrap(err, "could not change protection").Set("name", m.Name()).
+			Set("offset", offset).Set("size", size).Set("prot", prot)
+	}
+
+	m.protect = unprotect(m.protect, offset, size)
+	if prot != ProtectReadWrite {
+		m.protect = append(m.protect, protection{offset, size, prot})
+	}
+
+	return nil
+}
+
+// SetReadOnly makes a writeable map read-only without reopening it. Changes are
+// synced first and any open Direct slices and Writers are closed.
+func (m *Map) SetReadOnly() error {
+	m.lock()
+	defer m.Unlock()
+
+	if m.data == nil {
+		return errors.New("mmap closed").Set("name", m.Name())
+	}
+
+	if !m.write {
+		return nil
+	}
+
+	err := m.checkLeases()
+	if err != nil {
+		return errors.Wrap(err, "cannot make map read-only").Set("name", m.Name())
+	}
+
+	m.closeDirects()
+	m.closeWriters()
+
+	err = m.sync(true)
+	if err != nil {
+		return errors.Wrap(err, "could not sync before making map read-only").Set("name", m.Name())
+	}
+
+	err = mprotect(m.data, ProtectRead)
+	if err != nil {
+		return errors.Wrap(err, "could not make map read-only").Set("name", m.Name())
+	}
+
+	m.write = false
+	m.wsync = false
+
+	// Keep regions that can't be read.
+	protect := m.protect[:0]
+	for _, p := range m.protect {
+		if p.prot == ProtectNone {
+			protect = append(protect, p)
+		}
+	}
+	m.protect = protect
+
+	return m.reprotect()
+}
+
+// checkProtect returns an error if any of the size bytes of the map at offset
+// are protected against reading, or writing if write is true.
+// Lock the map before calling.
+func (m *Map) checkProtect(offset int, size int, write bool) error {
+	for _, p := range m.protect {
+		if p.offset < offset+size && offset < p.offset+p.size && (write || p.prot == ProtectNone) {
+			return errors.New("region is protected").Set("name", m.Name()).
+				Set("offset", offset).Set("size", size).
+				Set("protected_offset", p.offset).Set("protected_size", p.size)
+		}
+	}
+	return nil
+}
+
+// readable returns the end of the part of the map between offset and end that
+// can be read. Lock the map before calling.
+func (m *Map) readable(offset int, end int) int {
+	for _, p := range m.protect {
+		if p.prot == ProtectNone && p.offset < end && offset < p.offset+p.size {
+			end = p.offset
+			if end < offset {
+				end = offset
+			}
+		}
+	}
+	return end
+}
+
+// reprotect applies the protections to a new mapping, dropping any that are
+// past its end. Lock the map before calling.
+func (m *Map) reprotect() error {
+	protect := m.protect[:0]
+	for _, p := range m.protect {
+		if len(m.data) <= p.offset {
+			continue
+		}
+		if p.offset+p.size > len(m.data) {
+			p.size = len(m.data) - p.offset
+		}
+
+		err := mprotect(m.data[p.offset:p.offset+p.size], p.prot)
+		if err != nil {
+			return errors.Wrap(err, "could not restore protection").Set("name", m.Name()).
+				Set("offset", p.offset).Set("size", p.size)
+		}
+		protect = append(protect, p)
+	}
+	m.protect = protect
+
+	return nil
+}
+
+// copyData copies the map into data, a new mapping that replaces it, including
+// regions that can't be read. The protections of the map are unchanged.
+// Lock the map before calling.
+func (m *Map) copyData(data []byte) error {
+	err := m.setProtect(ProtectNone, ProtectRead)
+	if err != nil {
+		m.setProtect(ProtectNone, ProtectNone)
+		return errors.Wrap(err, "could not make protected region readable").Set("name", m.Name())
+	}
+
+	copy(data, m.data)
+
+	err = m.setProtect(ProtectNone, ProtectNone)
+	if err != nil {
+		return errors.Wrap(err, "could not restore protection").Set("name", m.Name())
+	}
+
+	return nil
+}
+
+// setProtect sets the protection of the regions of the map protected with from
+// to prot. Lock the map before calling.
+func (m *Map) setProtect(from Protection, prot Protection) error {
+	for _, p := range m.protect {
+		if p.prot != from {
+			continue
+		}
+
+		err := mprotect(m.data[p.offset:p.offset+p.size], prot)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unprotect removes the region at offset from the protections, splitting any
+// that partially overlap it.
+func unprotect(protect []protection, offset int, size int) []protection {
+	end := offset + size
+
+	var kept []protection
+	for _, p := range protect {
+		pend := p.offset + p.size
+		if pend <= offset || end <= p.offset {
+			kept = append(kept, p)
+			continue
+		}
+		if p.offset < offset {
+			kept = append(kept, protection{p.offset, offset - p.offset, p.prot})
+		}
+		if end < pend {
+			kept = append(kept, protection{end, pend - end, p.prot})
+		}
+	}
+
+	return kept
+}
@@ -0,0 +1,77 @@
+package mmap
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+func TestProtectResize(t *testing.T) {
+	page := os.Getpagesize()
+	m, err := Anonymous(2*page, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	w, _ := m.Writer()
+	w.WriteAt([]byte("x"), 0)
+
+	if err := m.Protect(0, page, ProtectNone); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Truncate(int64(4 * page)); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Reserve(8 * page); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Truncate(int64(6 * page)); err != nil {
+		t.Fatal(err)
+	}
+
+	r, _ := m.Reader()
+	if _, err := r.Peek(0); err == nil {
+		t.Fatal("protection lost when resizing")
+	}
+
+	if err := m.Protect(0, page, ProtectReadWrite); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := r.Peek(0); err != nil || c != 'x' {
+		t.Fatalf("read %q, %v after resizing, want 'x'", c, err)
+	}
+}
+
+func TestProtectChecks(t *testing.T) {
+	page := os.Getpagesize()
+	m, done := tempMap(t, 2*page)
+	defer done()
+
+	if err := m.Protect(0, page, ProtectRead); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.PunchHole(0, page); err == nil {
+		t.Fatal("PunchHole succeeded on a read-only region")
+	}
+
+	r, _ := m.Reader()
+	_, release, err := r.Borrow(page, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Protect(page, page, ProtectNone); err == nil {
+		t.Fatal("Protect succeeded with a borrowed slice")
+	}
+	release()
+
+	if err := m.Protect(page, page, ProtectNone); err != nil {
+		t.Fatal(err)
+	}
+	err = m.ParallelScan(context.Background(), 2, 100, nil, func(ctx context.Context, offset int, chunk []byte) error {
+		return nil
+	})
+	if err == nil {
+		t.Fatal("ParallelScan succeeded on a protected map")
+	}
+}
@@ -0,0 +1,140 @@
+package mmap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// CreateTemp creates a new writeable map backed by a temporary file in dir,
+// configured by opts. The file name is generated from pattern as by
+// ioutil.TempFile. Once the file is initialized, Publish moves it to its final
+// name, so other processes never see a partially written file. The read-only
+// and file creation flags are ignored.
+func CreateTemp(dir string, pattern string, opts ...Option) (*Map, error) {
+	o := newOptions(opts)
+	m, err := createTemp(dir, pattern, o)
+	if err != nil {
+		return opened(filepath.Join(dir, pattern), o, nil, err)
+	}
+	return opened(m.Name(), o, m, nil)
+}
+
+func createTemp(dir string, pattern string, o *options) (*Map, error) {
+	file, err := ioutil.TempFile(dir, pattern)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create temporary file").
+			Set("dir", dir).Set("pattern", pattern)
+	}
+	name := file.Name()
+
+	m, err := createTempFile(file, name, o)
+	if err != nil {
+		os.Remove(name)
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// createTempFile maps a new temporary file. The file is removed by the caller
+// on error.
+func createTempFile(file *os.File, name string, o *options) (*Map, error) {
+	if o.mode != 0600 {
+		err := file.Chmod(o.mode)
+		if err != nil {
+			file.Close()
+			return nil, errors.Wrap(err, "could not set file mode").Set("name", name).
+				Set("mode", o.mode)
+		}
+	}
+
+	m, err := openFile(file, name, true, false, o)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	m.wsync = o.wsync()
+
+	err = m.configure(o)
+	if err == nil && m.durable {
+		err = m.syncFile(true)
+	}
+	if err != nil {
+		m.closeMap()
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Publish flushes the map and its backing file to disk and atomically renames
+// the file to name, replacing any existing file. The directories involved are
+// synced so the rename survives a crash. The map stays open under its new name.
+func (m *Map) Publish(name string) error {
+	m.lock()
+	defer m.Unlock()
+
+	err := m.publish(name)
+	m.hookError("publish", err)
+
+	return err
+}
+
+// publish does the work of Publish. Lock the map before calling.
+func (m *Map) publish(name string) error {
+	if m.data == nil {
+		return errors.New("mmap closed").Set("name", m.Name())
+	}
+
+	if m.file == nil {
+		return errors.New("cannot publish anonymous map")
+	}
+
+	if m.write {
+		err := m.msync(m.data, true)
+		if err != nil {
+			return errors.Wrap(err, "could not sync map before publish").Set("name", m.Name())
+		}
+	}
+
+	err := m.file.Sync()
+	if err != nil {
+		return errors.Wrap(err, "could not sync file before publish").Set("name", m.Name())
+	}
+
+	err = os.Rename(m.Name(), name)
+	if err != nil {
+		return errors.Wrap(err, "could not rename file").Set("name", m.Name()).
+			Set("new_name", name)
+	}
+
+	old := m.Name()
+	m.name.Store(name)
+
+	err = syncDir(filepath.Dir(name))
+	if err == nil && filepath.Dir(old) != filepath.Dir(name) {
+		err = syncDir(filepath.Dir(old))
+	}
+	if err != nil {
+		return errors.Wrap(err, "could not sync directory after publish").Set("name", name)
+	}
+
+	return nil
+}
+
+// syncDir flushes the entries of a directory to disk.
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	err = file.Sync()
+	cerr := file.Close()
+	if err == nil {
+		err = cerr
+	}
+
+	return err
+}
@@ -0,0 +1,75 @@
+package mmap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCreateTempPublish(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	final := filepath.Join(dir, "final")
+	if err := ioutil.WriteFile(final, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := CreateTemp(dir, "tmp-*", WithInitialSize(100), WithMode(0644), WithReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if m.Size() != 100 || !m.Writeable() {
+		t.Fatalf("CreateTemp mapped %d bytes, writeable %v, want 100, true", m.Size(), m.Writeable())
+	}
+	temp := m.Name()
+	if filepath.Dir(temp) != dir || !strings.HasPrefix(filepath.Base(temp), "tmp-") {
+		t.Fatalf("CreateTemp created %s", temp)
+	}
+
+	w, _ := m.Writer()
+	w.WriteString("hello")
+
+	// The existing file is replaced only when the new one is published.
+	if b, _ := ioutil.ReadFile(final); string(b) != "old" {
+		t.Fatalf("%s contains %q before Publish", final, b)
+	}
+	if err := m.Publish(final); err != nil {
+		t.Fatal(err)
+	}
+	if m.Name() != final {
+		t.Fatalf("map is named %s after Publish, want %s", m.Name(), final)
+	}
+	if _, err := os.Stat(temp); !os.IsNotExist(err) {
+		t.Fatal("temporary file still exists after Publish:", err)
+	}
+
+	// The map stays open.
+	w.WriteString(" world")
+	m.Sync(true)
+
+	b, _ := ioutil.ReadFile(final)
+	if len(b) != 100 || string(b[:11]) != "hello world" {
+		t.Fatalf("published file contains %q", b)
+	}
+	if info, _ := os.Stat(final); info.Mode().Perm() != 0644 {
+		t.Fatalf("published file has mode %v, want %v", info.Mode().Perm(), os.FileMode(0644))
+	}
+
+	a, err := Anonymous(100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	if err := a.Publish(filepath.Join(dir, "anon")); err == nil {
+		t.Fatal("Publish of an anonymous map succeeded")
+	}
+}
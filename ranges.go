@@ -0,0 +1,196 @@
+package mmap
+
+import (
+	"bytes"
+	"os"
+)
+
+// zeroFallocateMin is the smallest range Zero clears with fallocate instead of
+// writing to memory.
+const zeroFallocateMin = 1 << 20
+
+// Move copies n bytes within the map from offset src to offset dst. The ranges
+// may overlap. Offsets are relative to the Writer's section, if any, and the
+// Writer's offset is not changed.
+func (w *Writer) Move(dst int, src int, n int) error {
+	w.access.RLock()
+	defer w.access.RUnlock()
+
+	w.lock()
+	defer w.Unlock()
+
+	data, err := w.view()
+	if err != nil {
+		return err
+	}
+
+	err = w.checkRange(data, src, n)
+	if err != nil {
+		return errors.Wrap(err, "invalid source range").Set("name", w.Name())
+	}
+
+	err = w.checkRange(data, dst, n)
+	if err != nil {
+		return errors.Wrap(err, "invalid destination range").Set("name", w.Name())
+	}
+
+	err = w.checkProtect(w.base+src, n, false)
+	if err == nil {
+		err = w.checkProtect(w.base+dst, n, true)
+	}
+	if err != nil {
+		return err
+	}
+
+	w.preserve(w.base+dst, n)
+	copy(data[dst:dst+n], data[src:src+n])
+	w.stats.addRead(n)
+	w.stats.addWritten(n)
+
+	return w.syncWrite(dst, n)
+}
+
+// Fill sets n bytes of the map starting at offset to b. The offset is relative
+// to the Writer's section, if any, and the Writer's offset is not changed.
+func (w *Writer) Fill(offset int, n int, b byte) error {
+	w.access.RLock()
+	defer w.access.RUnlock()
+
+	w.lock()
+	defer w.Unlock()
+
+	data, err := w.view()
+	if err != nil {
+		return err
+	}
+
+	err = w.checkRange(data, offset, n)
+	if err != nil {
+		return err
+	}
+
+	err = w.checkProtect(w.base+offset, n, true)
+	if err != nil {
+		return err
+	}
+
+	w.preserve(w.base+offset, n)
+	fill(data[offset:offset+n], b)
+	w.stats.addWritten(n)
+
+	return w.syncWrite(offset, n)
+}
+
+// Zero sets n bytes of the map starting at offset to zero. The offset is relative
+// to the Writer's section, if any, and the Writer's offset is not changed.
+// Where supported, the whole pages of large ranges are zeroed in the backing file
+// with fallocate rather than written through the map.
+func (w *Writer) Zero(offset int, n int) error {
+	w.access.RLock()
+	defer w.access.RUnlock()
+
+	w.lock()
+	defer w.Unlock()
+
+	data, err := w.view()
+	if err != nil {
+		return err
+	}
+
+	err = w.checkRange(data, offset, n)
+	if err != nil {
+		return err
+	}
+
+	start, end := w.base+offset, w.base+offset+n
+
+	err = w.checkProtect(start, n, true)
+	if err != nil {
+		return err
+	}
+
+	w.stats.addWritten(n)
+	w.preserve(start, n)
+
+	if n >= zeroFallocateMin && w.file != nil {
+		page := os.Getpagesize()
+		first := (start + page - 1) / page * page
+		last := end / page * page
+
+		if first < last && zeroRange(w.file, int64(first), int64(last-first)) == nil {
+			fill(w.data[start:first], 0)
+			fill(w.data[last:end], 0)
+			return w.syncWrite(offset, n)
+		}
+	}
+
+	fill(w.data[start:end], 0)
+
+	return w.syncWrite(offset, n)
+}
+
+// Compare compares len(b) bytes of the map starting at offset with b. The result
+// is 0 if they are equal, -1 if the map bytes are less and +1 if they are
+// greater. The offset is relative to the Reader's section, if any.
+func (r *Reader) Compare(offset int, b []byte) (int, error) {
+	r.access.RLock()
+	defer r.access.RUnlock()
+
+	r.rlock()
+	defer r.RUnlock()
+
+	data, err := r.view()
+	if err != nil {
+		return 0, err
+	}
+
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	err = r.checkRange(data, offset, len(b))
+	if err != nil {
+		return 0, err
+	}
+
+	err = r.checkProtect(r.base+offset, len(b), false)
+	if err != nil {
+		return 0, err
+	}
+
+	return bytes.Compare(data[offset:offset+len(b)], b), nil
+}
+
+// Equal reports whether the len(b) bytes of the map starting at offset are
+// the same as b. The offset is relative to the Reader's section, if any.
+func (r *Reader) Equal(offset int, b []byte) (bool, error) {
+	c, err := r.Compare(offset, b)
+	return c == 0 && err == nil, err
+}
+
+// syncWrite flushes the pages containing a range of the Writer's view if the
+// map uses synchronous writes. Lock the map before calling.
+func (w *Writer) syncWrite(offset int, n int) error {
+	if !w.wsync {
+		return nil
+	}
+
+	err := w.syncRange(w.base+offset, n)
+	if err != nil {
+		return errors.Wrap(err, "sync error").Set("name", w.Name())
+	}
+
+	return nil
+}
+
+// fill sets every byte of data to b.
+func fill(data []byte, b byte) {
+	if len(data) == 0 {
+		return
+	}
+
+	data[0] = b
+	for i := 1; i < len(data); i *= 2 {
+		copy(data[i:], data[:i])
+	}
+}
@@ -0,0 +1,122 @@
+package mmap
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMove(t *testing.T) {
+	m, done := tempMap(t, 10)
+	defer done()
+
+	w, _ := m.Writer()
+	w.WriteString("0123456789")
+
+	// Forwards and backwards over themselves.
+	if err := w.Move(2, 0, 6); err != nil {
+		t.Fatal(err)
+	}
+	if eq, _ := w.Equal(0, []byte("0101234589")); !eq {
+		t.Fatal("forward Move copied the wrong bytes")
+	}
+	if err := w.Move(0, 3, 7); err != nil {
+		t.Fatal(err)
+	}
+	if eq, _ := w.Equal(0, []byte("1234589589")); !eq {
+		t.Fatal("backward Move copied the wrong bytes")
+	}
+
+	if err := w.Move(5, 0, 6); err == nil {
+		t.Fatal("Move past the end of the map succeeded")
+	}
+	if err := w.Move(0, -1, 2); err == nil {
+		t.Fatal("Move from before the start of the map succeeded")
+	}
+
+	// Offsets are relative to the section.
+	s, _ := m.SectionWriter(4, 4)
+	if err := s.Move(0, 2, 2); err != nil {
+		t.Fatal(err)
+	}
+	if eq, _ := w.Equal(0, []byte("1234959589")); !eq {
+		t.Fatal("Move in a section copied the wrong bytes")
+	}
+	if err := s.Move(3, 0, 2); err == nil {
+		t.Fatal("Move past the end of the section succeeded")
+	}
+}
+
+func TestFillZero(t *testing.T) {
+	size := 4*zeroFallocateMin + 100
+	m, done := tempMap(t, size)
+	defer done()
+
+	w, _ := m.Writer()
+	if err := w.Fill(0, size, 'x'); err != nil {
+		t.Fatal(err)
+	}
+
+	// A small range is written through the map.
+	if err := w.Zero(10, 5); err != nil {
+		t.Fatal(err)
+	}
+	if eq, _ := w.Equal(9, []byte("x\x00\x00\x00\x00\x00x")); !eq {
+		t.Fatal("Zero cleared the wrong bytes")
+	}
+
+	// A large range that isn't page aligned may be cleared in the file.
+	start, n := 100, 3*zeroFallocateMin+7
+	if err := w.Zero(start, n); err != nil {
+		t.Fatal(err)
+	}
+	r, _ := m.Reader()
+	b := make([]byte, size)
+	r.ReadAt(b, 0)
+	want := bytes.Repeat([]byte("x"), size)
+	copy(want[10:15], make([]byte, 5))
+	copy(want[start:start+n], make([]byte, n))
+	if !bytes.Equal(b, want) {
+		t.Fatal("Zero of a large range cleared the wrong bytes")
+	}
+
+	if err := w.Fill(size-1, 2, 'y'); err == nil {
+		t.Fatal("Fill past the end of the map succeeded")
+	}
+	if err := w.Zero(0, 0); err == nil {
+		t.Fatal("empty Zero succeeded")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	m, done := tempMap(t, 8)
+	defer done()
+
+	w, _ := m.Writer()
+	w.WriteString("abcdefgh")
+
+	r, _ := m.SectionReader(2, 4)
+	tests := []struct {
+		offset int
+		b      string
+		want   int
+	}{
+		{0, "cdef", 0},
+		{1, "de", 0},
+		{0, "cdee", 1},
+		{0, "cdeg", -1},
+		{3, "", 0},
+	}
+	for _, test := range tests {
+		c, err := r.Compare(test.offset, []byte(test.b))
+		if c != test.want || err != nil {
+			t.Errorf("Compare(%d, %q) returned %d, %v, want %d, nil", test.offset, test.b, c, err, test.want)
+		}
+	}
+
+	if _, err := r.Compare(3, []byte("fg")); err == nil {
+		t.Fatal("Compare past the end of the section succeeded")
+	}
+	if eq, err := r.Equal(2, []byte("ef")); !eq || err != nil {
+		t.Fatalf("Equal returned %v, %v, want true, nil", eq, err)
+	}
+}
@@ -1,8 +1,12 @@
 package mmap
 
 import (
+	"bytes"
 	"io"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"unicode/utf8"
 )
 
 // Constants used for whence in Seek.
@@ -15,24 +19,37 @@ const (
 // Reader reads from a map. It implements the following interfaces from the
 // io standard package:
 //
-//     - Reader     (Read)
-//     - ReaderAt   (ReadAt)
-//     - ByteReader (ReadByte)
-//     - Seeker     (Seek)
-//     - Closer     (Close)
-//     - ReadCloser (Read, Close)
-//     - ReadSeeker (Read, Seek)
+//     - Reader      (Read)
+//     - ReaderAt    (ReadAt)
+//     - ByteReader  (ReadByte)
+//     - ByteScanner (ReadByte, UnreadByte)
+//     - RuneReader  (ReadRune)
+//     - RuneScanner (ReadRune, UnreadRune)
+//     - WriterTo    (WriteTo)
+//     - Seeker      (Seek)
+//     - Closer      (Close)
+//     - ReadCloser  (Read, Close)
+//     - ReadSeeker  (Read, Seek)
+//
+// A Reader created with SectionReader is bound to a region of the map. Its
+// offsets, Seek and io.EOF are relative to that region and it cannot read
+// outside of it.
 type Reader struct {
 	*Map
-	access sync.RWMutex
-	closed bool
-	id     int
-	offset int
+	access  sync.RWMutex
+	closed  int32
+	id      int
+	offset  int
+	unread  int // -1 after a byte read, the rune size after ReadRune, 0 otherwise
+	section bool
+	base    int
+	size    int
+	snap    *snapshot
 }
 
 // Reader returns a new Reader for the map.
 func (m *Map) Reader() (*Reader, error) {
-	m.Lock()
+	m.lock()
 	defer m.Unlock()
 
 	if m.data == nil {
@@ -52,32 +69,109 @@ func (m *Map) Reader() (*Reader, error) {
 	}
 
 	m.readers[id] = reader
+	atomic.AddInt64(&m.stats.readers, 1)
+	m.hookAccessor(ReaderAccessor, true)
+
+	return reader, nil
+}
+
+// SectionReader returns a new Reader bound to the region of the map specified
+// by offset and size.
+func (m *Map) SectionReader(offset int, size int) (*Reader, error) {
+	m.lock()
+	defer m.Unlock()
+
+	if m.data == nil {
+		return nil, errors.New("mmap closed").Set("name", m.Name())
+	}
+
+	if len(m.direct) > 0 {
+		return nil, errors.New("mmap has open direct access pointers").Set("name", m.Name())
+	}
+
+	err := m.checkRegion(offset, size)
+	if err != nil {
+		return nil, err
+	}
+
+	id := m.id
+	m.id++
+
+	reader := &Reader{
+		Map:     m,
+		id:      id,
+		section: true,
+		base:    offset,
+		size:    size,
+	}
+
+	m.readers[id] = reader
+	atomic.AddInt64(&m.stats.readers, 1)
+	m.hookAccessor(ReaderAccessor, true)
 
 	return reader, nil
 }
 
+// isClosed reports if the Reader has been closed.
+func (r *Reader) isClosed() bool {
+	return atomic.LoadInt32(&r.closed) != 0
+}
+
+// view returns the part of the map visible to the Reader. It returns an error
+// if the map or the Reader has been closed, which can happen while waiting for
+// the map lock, or if the map has shrunk and no longer contains the Reader's
+// section. Lock map before calling.
+func (r *Reader) view() ([]byte, error) {
+	if r.data == nil {
+		return nil, errors.New("mmap closed").Set("name", r.Name())
+	}
+
+	if r.isClosed() {
+		return nil, errors.New("mmap reader closed").Set("name", r.Name())
+	}
+
+	data := r.data
+	if r.snap != nil {
+		data = r.snap.data
+	}
+	if !r.section {
+		return data, nil
+	}
+
+	if len(data) < r.base+r.size {
+		return nil, errors.New("section extends past end of map").Set("name", r.Name()).
+			Set("offset", r.base).Set("size", r.size).Set("mmap_size", len(data))
+	}
+
+	return data[r.base : r.base+r.size], nil
+}
+
 // Peek returns the value of the byte at offset.
 func (r *Reader) Peek(offset int) (byte, error) {
 	r.access.RLock()
 	defer r.access.RUnlock()
 
-	if r.closed {
-		return 0, errors.New("mmap reader closed").Set("name", r.name)
-	}
-
-	r.RLock()
+	r.rlock()
 	defer r.RUnlock()
 
-	if r.data == nil {
-		return 0, errors.New("mmap closed").Set("name", r.name)
+	data, err := r.view()
+	if err != nil {
+		return 0, err
 	}
 
-	if offset < 0 || len(r.data) <= offset {
-		return 0, errors.New("offset out of range").Set("name", r.name).
-			Set("offset", offset).Set("map_size", len(r.data))
+	if offset < 0 || len(data) <= offset {
+		return 0, errors.New("offset out of range").Set("name", r.Name()).
+			Set("offset", offset).Set("map_size", len(data))
 	}
 
-	return r.data[offset], nil
+	err = r.checkProtect(r.base+offset, 1, false)
+	if err != nil {
+		return 0, err
+	}
+
+	r.stats.addRead(1)
+
+	return data[offset], nil
 }
 
 // Read reads up to len(b) bytes from the map Reader. It returns the number of bytes read
@@ -86,18 +180,15 @@ func (r *Reader) Read(b []byte) (n int, err error) {
 	r.access.Lock()
 	defer r.access.Unlock()
 
-	if r.closed {
-		return 0, errors.New("mmap reader closed").Set("name", r.name)
-	}
-
-	r.RLock()
+	r.rlock()
 	defer r.RUnlock()
 
-	if r.data == nil {
-		return 0, errors.New("mmap closed").Set("name", r.name)
+	data, err := r.view()
+	if err != nil {
+		return 0, err
 	}
 
-	if len(r.data) <= r.offset {
+	if len(data) <= r.offset {
 		return 0, io.EOF
 	}
 
@@ -105,8 +196,15 @@ func (r *Reader) Read(b []byte) (n int, err error) {
 		return 0, nil
 	}
 
-	n = copy(b, r.data[r.offset:])
+	err = r.checkProtect(r.base+r.offset, minInt(len(b), len(data)-r.offset), false)
+	if err != nil {
+		return 0, err
+	}
+
+	n = copy(b, data[r.offset:])
 	r.offset += n
+	r.unread = -1
+	r.stats.addRead(n)
 
 	return n, nil
 }
@@ -118,27 +216,30 @@ func (r *Reader) ReadAt(b []byte, offset int64) (n int, err error) {
 	r.access.RLock()
 	defer r.access.RUnlock()
 
-	if r.closed {
-		return 0, errors.New("mmap reader closed").Set("name", r.name)
-	}
-
-	r.RLock()
+	r.rlock()
 	defer r.RUnlock()
 
-	if r.data == nil {
-		return 0, errors.New("mmap closed").Set("name", r.name)
+	data, err := r.view()
+	if err != nil {
+		return 0, err
 	}
 
 	if len(b) == 0 {
 		return 0, nil
 	}
 
-	if offset < 0 || int64(len(r.data)) <= offset {
-		return 0, errors.New("offset out of range").Set("name", r.name).
-			Set("offset", offset).Set("map_size", len(r.data))
+	if offset < 0 || int64(len(data)) <= offset {
+		return 0, errors.New("offset out of range").Set("name", r.Name()).
+			Set("offset", offset).Set("map_size", len(data))
 	}
 
-	n = copy(b, r.data[offset:])
+	err = r.checkProtect(r.base+int(offset), minInt(len(b), len(data)-int(offset)), false)
+	if err != nil {
+		return 0, err
+	}
+
+	n = copy(b, data[offset:])
+	r.stats.addRead(n)
 	if n < len(b) {
 		return n, io.EOF
 	}
@@ -151,27 +252,263 @@ func (r *Reader) ReadByte() (byte, error) {
 	r.access.Lock()
 	defer r.access.Unlock()
 
-	if r.closed {
-		return 0, errors.New("mmap reader closed").Set("name", r.name)
-	}
-
-	r.RLock()
+	r.rlock()
 	defer r.RUnlock()
 
-	if r.data == nil {
-		return 0, errors.New("mmap closed").Set("name", r.name)
+	data, err := r.view()
+	if err != nil {
+		return 0, err
 	}
 
-	if len(r.data) <= r.offset {
+	if len(data) <= r.offset {
 		return 0, io.EOF
 	}
 
-	b := r.data[r.offset]
+	err = r.checkProtect(r.base+r.offset, 1, false)
+	if err != nil {
+		return 0, err
+	}
+
+	b := data[r.offset]
 	r.offset++
+	r.unread = -1
+	r.stats.addRead(1)
 
 	return b, nil
 }
 
+// UnreadByte unreads the last byte. Only the most recently read byte can be unread.
+func (r *Reader) UnreadByte() error {
+	r.access.Lock()
+	defer r.access.Unlock()
+
+	if r.isClosed() {
+		return errors.New("mmap reader closed").Set("name", r.Name())
+	}
+
+	if r.unread == 0 || r.offset < 1 {
+		return errors.New("invalid use of UnreadByte").Set("name", r.Name())
+	}
+
+	r.offset--
+	r.unread = 0
+
+	return nil
+}
+
+// ReadRune reads a single UTF-8 encoded Unicode character and returns the
+// rune and its size in bytes. If the encoded rune is invalid, it consumes one byte
+// and returns unicode.ReplacementChar (U+FFFD) with a size of 1.
+// It returns io.EOF if the Reader is at the end of the file.
+func (r *Reader) ReadRune() (ch rune, size int, err error) {
+	r.access.Lock()
+	defer r.access.Unlock()
+
+	r.rlock()
+	defer r.RUnlock()
+
+	data, err := r.view()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if len(data) <= r.offset {
+		return 0, 0, io.EOF
+	}
+
+	err = r.checkProtect(r.base+r.offset, minInt(utf8.UTFMax, len(data)-r.offset), false)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	ch, size = utf8.DecodeRune(data[r.offset:])
+	r.offset += size
+	r.unread = size
+	r.stats.addRead(size)
+
+	return ch, size, nil
+}
+
+// UnreadRune unreads the last rune. It returns an error if the most recent
+// read operation on the Reader was not a ReadRune.
+func (r *Reader) UnreadRune() error {
+	r.access.Lock()
+	defer r.access.Unlock()
+
+	if r.isClosed() {
+		return errors.New("mmap reader closed").Set("name", r.Name())
+	}
+
+	if r.unread <= 0 || r.offset < r.unread {
+		return errors.New("invalid use of UnreadRune").Set("name", r.Name())
+	}
+
+	r.offset -= r.unread
+	r.unread = 0
+
+	return nil
+}
+
+// ReadSlice reads until the first occurrence of delim and returns a slice of the
+// map up to and including the delimiter. If ReadSlice reaches the end of the
+// map before finding delim, it returns the remaining data and io.EOF.
+//
+// The slice points directly into the map and is not a copy. It must not be
+// modified and is only valid until the next call on the Reader. It is also
+// invalidated by anything that maps the map again, on any goroutine, such as
+// Truncate, Reserve, Reload, SetHugePages or a Writer.ReadFrom that grows the
+// map. Use Borrow for a slice that stays valid until it is released.
+func (r *Reader) ReadSlice(delim byte) (line []byte, err error) {
+	r.access.Lock()
+	defer r.access.Unlock()
+
+	r.rlock()
+	defer r.RUnlock()
+
+	data, err := r.view()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) <= r.offset {
+		return nil, io.EOF
+	}
+
+	// Only search up to a region that can't be read.
+	limit := r.readable(r.base+r.offset, r.base+len(data)) - r.base
+
+	line = data[r.offset:limit]
+	i := bytes.IndexByte(line, delim)
+	if i < 0 {
+		if limit < len(data) {
+			return nil, r.checkProtect(r.base+limit, 1, false)
+		}
+		err = io.EOF
+	} else {
+		line = line[:i+1]
+	}
+
+	r.offset += len(line)
+	r.unread = -1
+	r.stats.addRead(len(line))
+
+	return line[:len(line):len(line)], err
+}
+
+// ReadLine returns the next line, not including the end-of-line bytes "\n" or
+// "\r\n", with the same contract as bufio.Reader.ReadLine. The last line of
+// the map does not need to end in a newline, and io.EOF is returned only when
+// there are no more lines. Since the whole map is available, lines are never
+// split and isPrefix is always false.
+//
+// Like ReadSlice, the line points directly into the map and is not a copy, and
+// it is only valid until the next call on the Reader or until the map is mapped
+// again.
+func (r *Reader) ReadLine() (line []byte, isPrefix bool, err error) {
+	line, err = r.ReadSlice('\n')
+	if err == io.EOF && len(line) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	n := len(line)
+	if n > 0 && line[n-1] == '\n' {
+		n--
+		if n > 0 && line[n-1] == '\r' {
+			n--
+		}
+	}
+
+	return line[:n:n], false, nil
+}
+
+// WriteTo writes the remainder of the map to w, starting at the Reader's offset,
+// until there is no more data or an error occurs. It returns the number of bytes
+// written. The bytes are passed to w straight from the map, or sent from the
+// backing file by the kernel when w is a socket or pipe, without being copied
+// through a buffer. The map isn't locked while writing to w, so a slow w doesn't
+// hold up other users of the map, but it holds a lease like Borrow until
+// WriteTo returns.
+func (r *Reader) WriteTo(w io.Writer) (n int64, err error) {
+	r.access.Lock()
+	defer r.access.Unlock()
+
+	r.unread = 0
+
+	data, err := r.pin()
+	if err != nil || len(data) == 0 {
+		return 0, err
+	}
+	defer r.unpin()
+
+	written, handled, err := r.sendfile(w, len(data))
+	if !handled {
+		written, err = w.Write(data)
+		if err == nil && written < len(data) {
+			err = io.ErrShortWrite
+		}
+	}
+
+	r.offset += written
+	r.stats.addRead(written)
+
+	return int64(written), err
+}
+
+// pin returns the rest of the Reader's view from its offset, and takes a lease
+// that keeps it mapped while the map is unlocked. If there is nothing left to
+// read, it returns nil without a lease. Otherwise call unpin when done with it.
+// Lock the Reader's access before calling.
+func (r *Reader) pin() ([]byte, error) {
+	r.lock()
+	defer r.Unlock()
+
+	data, err := r.view()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) <= r.offset {
+		return nil, nil
+	}
+
+	err = r.checkProtect(r.base+r.offset, len(data)-r.offset, false)
+	if err != nil {
+		return nil, err
+	}
+
+	r.lease()
+
+	return data[r.offset:len(data):len(data)], nil
+}
+
+// unpin releases the lease taken by pin.
+func (r *Reader) unpin() {
+	r.lock()
+	defer r.Unlock()
+
+	r.unlease()
+}
+
+// sendfile sends count bytes of the backing file from the Reader's offset to w,
+// if w is a socket or pipe. It reports false if w can't be used with sendfile or
+// the Reader doesn't read from the file. Pin the Reader's view before calling.
+func (r *Reader) sendfile(w io.Writer, count int) (int, bool, error) {
+	conn, ok := w.(syscall.Conn)
+	if !ok || r.file == nil || r.snap != nil {
+		return 0, false, nil
+	}
+
+	sent, handled, err := sendfile(conn, r.file, int64(r.base+r.offset), count)
+	if err != nil {
+		return sent, handled, errors.Wrap(err, "sendfile error").Set("name", r.Name())
+	}
+
+	return sent, handled, nil
+}
+
 // Seek sets the offset for the next Read or Write on Reader to offset, interpreted
 // according to whence: 0 means relative to the origin of the file, 1 means relative
 // to the current offset, and 2 means relative to the end. It returns the new offset
@@ -180,15 +517,12 @@ func (r *Reader) Seek(offset int64, whence int) (ret int64, err error) {
 	r.access.Lock()
 	defer r.access.Unlock()
 
-	if r.closed {
-		return 0, errors.New("mmap reader closed").Set("name", r.name)
-	}
-
-	r.Lock()
+	r.lock()
 	defer r.Unlock()
 
-	if r.data == nil {
-		return 0, errors.New("mmap closed").Set("name", r.name)
+	data, err := r.view()
+	if err != nil {
+		return 0, err
 	}
 
 	var pos int64
@@ -199,31 +533,32 @@ func (r *Reader) Seek(offset int64, whence int) (ret int64, err error) {
 	case SeekCurrent:
 		pos = int64(r.offset) + offset
 	case SeekEnd:
-		pos = int64(len(r.data)) + offset
+		pos = int64(len(data)) + offset
 	default:
-		return 0, errors.New("invalid whence").Set("name", r.name).Set("whence", whence)
+		return 0, errors.New("invalid whence").Set("name", r.Name()).Set("whence", whence)
 	}
 
-	if pos < 0 || int64(len(r.data)) <= pos {
-		return 0, errors.New("invalid position").Set("name", r.name).
+	if pos < 0 || int64(len(data)) <= pos {
+		return 0, errors.New("invalid position").Set("name", r.Name()).
 			Set("offset", offset).Set("whence", whence).
-			Set("map_size", len(r.data)).Set("position", pos)
+			Set("map_size", len(data)).Set("position", pos)
 	}
 
 	if pos != int64(int(pos)) {
-		return 0, errors.New("position is invalid for architecture").Set("name", r.name).
+		return 0, errors.New("position is invalid for architecture").Set("name", r.Name()).
 			Set("offset", offset).Set("whence", whence).
-			Set("map_size", len(r.data)).Set("position", pos)
+			Set("map_size", len(data)).Set("position", pos)
 	}
 
 	r.offset = int(pos)
+	r.unread = 0
 
 	return pos, nil
 }
 
 // Close closes the Reader.
 func (r *Reader) Close() error {
-	r.Lock()
+	r.lock()
 	defer r.Unlock()
 
 	r.close()
@@ -231,11 +566,24 @@ func (r *Reader) Close() error {
 	return nil
 }
 
-// Lock map before calling
+// close marks the Reader closed. It doesn't take the access lock, so the map
+// can close Readers that are in use by other goroutines, which notice when they
+// next lock the map. Lock map before calling.
 func (r *Reader) close() {
-	r.access.Lock()
-	defer r.access.Unlock()
+	if !atomic.CompareAndSwapInt32(&r.closed, 0, 1) {
+		return
+	}
+
+	kind := ReaderAccessor
+	if _, ok := r.writers[r.id]; ok {
+		kind = WriterAccessor
+	}
+
+	if r.snap != nil {
+		r.closeSnapshot()
+	}
 
-	r.closed = true
 	delete(r.readers, r.id)
+	delete(r.writers, r.id)
+	r.hookAccessor(kind, false)
 }
@@ -0,0 +1,213 @@
+package mmap
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClosedWhileWaiting(t *testing.T) {
+	page := os.Getpagesize()
+	m, done := tempMap(t, 4*page)
+	defer done()
+
+	w, _ := m.Writer()
+	r, err := m.SectionReader(3*page, page)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Hold the lock like Truncate does, so both calls wait for it after
+	// checking their accessor, then shrink the map and close the accessors.
+	m.lock()
+
+	errs := make(chan error, 2)
+	go func() {
+		_, err := w.WriteAt([]byte("x"), 0)
+		errs <- err
+	}()
+	go func() {
+		_, err := r.ReadAt(make([]byte, 1), 0)
+		errs <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	m.closeWriters()
+	m.closeReaders()
+	err = m.remap(page)
+	m.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err == nil {
+			t.Fatal("closed accessor used the new mapping")
+		}
+	}
+}
+
+func TestWriteTo(t *testing.T) {
+	page := os.Getpagesize()
+	m, done := tempMap(t, 4*page)
+	defer done()
+
+	w, _ := m.Writer()
+	data := bytes.Repeat([]byte("0123456789abcdef"), page/4)
+	w.Write(data)
+
+	r, _ := m.Reader()
+	r.Seek(10, SeekStart)
+
+	var buf bytes.Buffer
+	n, err := r.WriteTo(&buf)
+	if n != int64(len(data)-10) || err != nil {
+		t.Fatalf("WriteTo returned %d, %v, want %d, nil", n, err, len(data)-10)
+	}
+	if !bytes.Equal(buf.Bytes(), data[10:]) {
+		t.Fatal("WriteTo wrote the wrong data")
+	}
+
+	// A pipe is sent from the file by the kernel.
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Close()
+
+	got := make(chan []byte)
+	go func() {
+		b, _ := ioutil.ReadAll(pr)
+		got <- b
+	}()
+
+	r, _ = m.SectionReader(page, page)
+	n, err = r.WriteTo(pw)
+	pw.Close()
+	if n != int64(page) || err != nil {
+		t.Fatalf("WriteTo returned %d, %v, want %d, nil", n, err, page)
+	}
+	if !bytes.Equal(<-got, data[page:2*page]) {
+		t.Fatal("WriteTo sent the wrong data")
+	}
+
+	// The Reader is at the end of its section.
+	n, err = r.WriteTo(&buf)
+	if n != 0 || err != nil {
+		t.Fatalf("WriteTo at the end returned %d, %v, want 0, nil", n, err)
+	}
+
+	if err := m.Truncate(int64(page)); err != nil {
+		t.Fatal("WriteTo didn't release its lease:", err)
+	}
+}
+
+func TestRunesAndLines(t *testing.T) {
+	m, done := tempMap(t, 14)
+	defer done()
+
+	w, _ := m.Writer()
+	w.WriteString("héllo\r\nab\nxyz")
+
+	r, _ := m.Reader()
+	ch, size, err := r.ReadRune()
+	if ch != 'h' || size != 1 || err != nil {
+		t.Fatalf("ReadRune returned %q, %d, %v", ch, size, err)
+	}
+	ch, size, _ = r.ReadRune()
+	if ch != 'é' || size != 2 {
+		t.Fatalf("ReadRune returned %q, %d, want 'é', 2", ch, size)
+	}
+	if err := r.UnreadRune(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.UnreadRune(); err == nil {
+		t.Fatal("UnreadRune succeeded twice")
+	}
+
+	var lines []string
+	for {
+		line, isPrefix, err := r.ReadLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil || isPrefix {
+			t.Fatal(isPrefix, err)
+		}
+		lines = append(lines, string(line))
+	}
+	if got := strings.Join(lines, "|"); got != "éllo|ab|xyz" {
+		t.Fatalf("read lines %q, want %q", got, "éllo|ab|xyz")
+	}
+
+	// Like bufio, UnreadByte after ReadLine unreads the last byte read.
+	if err := r.UnreadByte(); err != nil {
+		t.Fatal(err)
+	}
+	if c, _ := r.ReadByte(); c != 'z' {
+		t.Fatalf("read %q after UnreadByte, want 'z'", c)
+	}
+
+	r.Seek(0, SeekStart)
+	line, err := r.ReadSlice('\n')
+	if string(line) != "héllo\r\n" || err != nil {
+		t.Fatalf("ReadSlice returned %q, %v", line, err)
+	}
+	r.ReadSlice('\n')
+	line, err = r.ReadSlice('\n')
+	if string(line) != "xyz" || err != io.EOF {
+		t.Fatalf("ReadSlice returned %q, %v, want %q, io.EOF", line, err, "xyz")
+	}
+}
+
+func TestSectionReader(t *testing.T) {
+	m, done := tempMap(t, 16)
+	defer done()
+
+	w, _ := m.Writer()
+	w.WriteString("0123456789abcdef")
+
+	if _, err := m.SectionReader(10, 7); err == nil {
+		t.Fatal("SectionReader past the end of the map succeeded")
+	}
+	if _, err := m.SectionReader(10, 0); err == nil {
+		t.Fatal("empty SectionReader succeeded")
+	}
+
+	r, err := m.SectionReader(4, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadAll(r)
+	if string(b) != "456789" || err != nil {
+		t.Fatalf("read %q, %v, want %q, nil", b, err, "456789")
+	}
+	if n, err := r.Read(b); n != 0 || err != io.EOF {
+		t.Fatalf("Read at the end returned %d, %v, want 0, io.EOF", n, err)
+	}
+
+	// Offsets are relative to the section.
+	pos, err := r.Seek(-2, SeekEnd)
+	if pos != 4 || err != nil {
+		t.Fatalf("Seek returned %d, %v, want 4, nil", pos, err)
+	}
+	if c, _ := r.ReadByte(); c != '8' {
+		t.Fatalf("read %q after Seek, want '8'", c)
+	}
+	if _, err := r.Seek(6, SeekStart); err == nil {
+		t.Fatal("Seek past the end of the section succeeded")
+	}
+	if _, err := r.Seek(-1, SeekStart); err == nil {
+		t.Fatal("Seek before the start of the section succeeded")
+	}
+
+	n, err := r.ReadAt(b[:4], 4)
+	if n != 2 || err != io.EOF || string(b[:n]) != "89" {
+		t.Fatalf("ReadAt returned %q, %v, want %q, io.EOF", b[:n], err, "89")
+	}
+}
@@ -0,0 +1,152 @@
+package mmap
+
+// Reserve reserves size bytes of address space for the map and moves the map to
+// the start of it. From then on, Truncate and Writer.ReadFrom resize the map in
+// place, so its address never changes until it is closed, but it can't grow
+// beyond size. The reserved space isn't backed by memory or disk until the map
+// grows into it. Any open Direct slices are closed.
+func (m *Map) Reserve(size int) error {
+	m.lock()
+	defer m.Unlock()
+
+	if m.data == nil {
+		return errors.New("mmap closed").Set("name", m.Name())
+	}
+
+	if m.reserve != nil {
+		return errors.New("map already has reserved address space").Set("name", m.Name()).
+			Set("reserved", len(m.reserve))
+	}
+
+	size = (size + m.page - 1) / m.page * m.page
+	if size < len(m.data) {
+		return errors.New("reservation smaller than map").Set("name", m.Name()).
+			Set("size", size).Set("mmap_size", len(m.data))
+	}
+
+	err := m.checkLeases()
+	if err != nil {
+		return errors.Wrap(err, "cannot move map to reserved address space").Set("name", m.Name())
+	}
+
+	m.closeDirects()
+
+	region, err := reserveAligned(size, m.page)
+	if err != nil {
+		return errors.Wrap(err, "could not reserve address space").Set("name", m.Name()).
+			Set("size", size)
+	}
+
+	err = m.mapFixed(region, 0, len(m.data))
+	if err != nil {
+		munmap(region)
+		return errors.Wrap(err, "could not map into reserved address space").Set("name", m.Name())
+	}
+
+	data := region[:len(m.data):len(m.data)]
+	if m.file == nil {
+		err = m.copyData(data)
+		if err != nil {
+			munmap(region)
+			return err
+		}
+	}
+
+	err = m.sync(true)
+	if err == nil {
+		err = munmap(m.data)
+	}
+	if err != nil {
+		munmap(region)
+		return errors.Wrap(err, "could not replace mapping").Set("name", m.Name())
+	}
+
+	m.data = data
+	m.reserve = region
+
+	return m.remapped()
+}
+
+// Reserved returns the size of the address space reserved for the map, or zero
+// if the map can be moved when it is resized.
+func (m *Map) Reserved() int {
+	m.rlock()
+	defer m.RUnlock()
+
+	return len(m.reserve)
+}
+
+// remapFixed resizes a map within its reserved address space.
+// Lock the map before calling.
+func (m *Map) remapFixed(size int) error {
+	if size > len(m.reserve) {
+		return errors.New("size exceeds reserved address space").Set("name", m.Name()).
+			Set("size", size).Set("reserved", len(m.reserve))
+	}
+
+	old := len(m.data)
+
+	if m.file != nil {
+		err := m.resizeFile(size)
+		if err != nil {
+			return err
+		}
+
+		err = m.mapFixed(m.reserve, 0, size)
+		if err != nil {
+			return errors.Wrap(err, "could not remap file").Set("name", m.Name()).
+				Set("size", size)
+		}
+	} else if size > old {
+		// Anonymous memory can't be remapped without losing its contents, so
+		// only the new pages are mapped.
+		start := (old + m.page - 1) / m.page * m.page
+		if start < size {
+			err := m.mapFixed(m.reserve, start, size-start)
+			if err != nil {
+				return errors.Wrap(err, "could not map anonymous memory").Set("name", m.Name()).
+					Set("size", size)
+			}
+		}
+		fill(m.reserve[old:start], 0)
+	}
+
+	if size < old {
+		start := (size + m.page - 1) / m.page * m.page
+		end := (old + m.page - 1) / m.page * m.page
+		if start < end {
+			_, err := reserveAt(dataAddr(m.reserve[start:]), end-start)
+			if err != nil {
+				return errors.Wrap(err, "could not release memory").Set("name", m.Name()).
+					Set("size", size)
+			}
+		}
+	}
+
+	m.data = m.reserve[:size:size]
+
+	return nil
+}
+
+// mapFixed maps size bytes into region, replacing what is mapped there. The
+// backing file is always mapped from the start of region and offset must be
+// zero. Anonymous memory is mapped at offset in region. Lock the map before
+// calling.
+func (m *Map) mapFixed(region []byte, offset int, size int) error {
+	var err error
+
+	if m.file == nil {
+		_, err = mmapAnonFixed(dataAddr(region[offset:]), size, m.hugetlb)
+	} else {
+		_, err = mmapFixed(dataAddr(region), m.file.Fd(), size, m.write)
+	}
+	if err != nil {
+		return err
+	}
+
+	if m.thp {
+		return adviseHugePages(region[offset:offset+size], true)
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package mmap
+
+import (
+	"os"
+	"testing"
+)
+
+func TestReserve(t *testing.T) {
+	page := os.Getpagesize()
+	m, done := tempMap(t, page)
+	defer done()
+
+	w, _ := m.Writer()
+	w.Write([]byte("reserved"))
+
+	if err := m.Reserve(4 * page); err != nil {
+		t.Fatal(err)
+	}
+	if m.Reserved() != 4*page {
+		t.Fatalf("reserved %d bytes, want %d", m.Reserved(), 4*page)
+	}
+
+	addr := func() *byte {
+		r, _ := m.Reader()
+		defer r.Close()
+
+		b, release, err := r.Borrow(0, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer release()
+		return &b[0]
+	}
+	start := addr()
+
+	if err := m.Truncate(int64(3 * page)); err != nil {
+		t.Fatal(err)
+	}
+	if addr() != start {
+		t.Fatal("map moved when growing")
+	}
+
+	if err := m.Truncate(int64(page)); err != nil {
+		t.Fatal(err)
+	}
+	if addr() != start {
+		t.Fatal("map moved when shrinking")
+	}
+
+	if err := m.Truncate(int64(5 * page)); err == nil {
+		t.Fatal("map grew beyond the reservation")
+	}
+
+	w, _ = m.Writer()
+	b := make([]byte, 8)
+	w.ReadAt(b, 0)
+	if string(b) != "reserved" {
+		t.Fatalf("read %q after resizing", b)
+	}
+}
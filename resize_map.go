@@ -2,60 +2,244 @@ package mmap
 
 import (
 	"os"
+	"sync/atomic"
 )
 
 // Truncate resizes the backing file and the memory map to the requested size.
-// Any open Direct, Readers, and Writers are closed.
+// Any open Direct, Readers, and Writers are closed. If preallocation is enabled
+// with SetPreallocate, disk space for the new part of the map is allocated first,
+// so a full disk is reported as an error and the map is left unchanged.
+// If the map uses huge pages, size is rounded up to a multiple of the page size.
 func (m *Map) Truncate(size int64) error {
+	if size < 1 {
+		return errors.New("size must be greater than zero").Set("name", m.Name())
+	}
+
+	m.lock()
+	defer m.Unlock()
+
 	if !m.write {
-		return errors.New("cannot truncate read-only map").Set("name", m.name)
+		return errors.New("cannot truncate read-only map").Set("name", m.Name())
 	}
 
-	if size < 1 {
-		return errors.New("size must be greater than zero").Set("name", m.name)
+	if m.page > os.Getpagesize() {
+		size = (size + int64(m.page) - 1) / int64(m.page) * int64(m.page)
 	}
 
-	m.Lock()
-	defer m.Unlock()
+	if size != int64(int(size)) {
+		return errors.New("size too large for architecture").
+			Set("name", m.Name()).Set("size", size)
+	}
 
 	if m.data == nil {
 		return errors.New("mmap closed")
 	}
 
+	err := m.checkLeases()
+	if err != nil {
+		return errors.Wrap(err, "cannot truncate map").Set("name", m.Name())
+	}
+
 	m.closeDirects()
 	m.closeWriters()
 	m.closeReaders()
 
-	err := m.sync(true)
+	err = m.remap(int(size))
 	if err != nil {
-		return errors.Wrap(err, "could not sync before truncate").Set("name", m.name)
+		return errors.Wrap(err, "could not truncate map").Set("name", m.Name())
+	}
+
+	m.id = 0
+
+	return nil
+}
+
+// remap resizes the backing file and maps it again. Readers and Writers keep
+// their offsets, but Direct slices must be closed first.
+// Lock the map and check that it is open and writeable before calling.
+func (m *Map) remap(size int) error {
+	old := len(m.data)
+
+	err := m.resize(size)
+	m.hookError("truncate", err)
+	if m.hooks != nil && m.hooks.Truncate != nil {
+		m.hooks.Truncate(m.Name(), old, size, err)
+	}
+
+	return err
+}
+
+// resize does the work of remap.
+func (m *Map) resize(size int) error {
+	err := m.checkLeases()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case m.reserve != nil:
+		err = m.remapFixed(size)
+	case m.file == nil:
+		err = m.remapAnon(size)
+	default:
+		err = m.remapFile(size)
+	}
+	if err != nil {
+		return err
+	}
+
+	atomic.AddInt64(&m.stats.resizes, 1)
+
+	return m.remapped()
+}
+
+// remapFile resizes the backing file and replaces the mapping.
+// Lock the map before calling.
+func (m *Map) remapFile(size int) error {
+	err := m.resizeFile(size)
+	if err != nil {
+		return err
 	}
 
 	err = m.unmap()
 	if err != nil {
-		return errors.Wrap(err, "could not unmap map before truncate").Set("name", m.name)
+		return errors.Wrap(err, "could not unmap map before resize").Set("name", m.Name())
+	}
+
+	data, err := m.mmap(size)
+	if err != nil {
+		return errors.Wrap(err, "could not mmap file after resize").
+			Set("name", m.Name()).Set("size", size)
 	}
 
-	file, err := os.OpenFile(m.name, os.O_RDWR, 0)
+	m.data = data
+
+	return nil
+}
+
+// resizeFile syncs the map and resizes the backing file, allocating disk space
+// first if preallocation is enabled. Lock the map before calling.
+func (m *Map) resizeFile(size int) error {
+	err := m.sync(true)
 	if err != nil {
-		return errors.Wrap(err, "error opening file for truncate").
-			Set("name", m.name).Set("size", size)
+		return errors.Wrap(err, "could not sync before resize").Set("name", m.Name())
 	}
-	defer file.Close()
 
-	err = file.Truncate(int64(size))
+	if m.falloc && size > len(m.data) {
+		err = preallocate(m.file, int64(len(m.data)), int64(size-len(m.data)))
+		if err != nil {
+			m.file.Truncate(int64(len(m.data)))
+			return errors.Wrap(err, "could not allocate space for resize").
+				Set("name", m.Name()).Set("size", size)
+		}
+	}
+
+	err = m.file.Truncate(int64(size))
 	if err != nil {
 		return errors.Wrap(err, "error truncating file").
-			Set("name", m.name).Set("size", size)
+			Set("name", m.Name()).Set("size", size)
 	}
 
-	data, err := mmap(file.Fd(), int(size), true)
+	if m.durable {
+		return m.syncFile(true)
+	}
+
+	return nil
+}
+
+// remapAnon replaces the memory of an anonymous map with a new mapping of the
+// given size, copying over the contents. Lock the map before calling.
+func (m *Map) remapAnon(size int) error {
+	data, err := m.mmap(size)
 	if err != nil {
-		return errors.New("could not mmap file after truncate").Set("name", m.name)
+		return errors.Wrap(err, "could not map anonymous memory for resize").
+			Set("name", m.Name()).Set("size", size)
+	}
+
+	err = m.copyData(data)
+	if err != nil {
+		munmap(data)
+		return err
+	}
+
+	err = m.unmap()
+	if err != nil {
+		munmap(data)
+		return errors.Wrap(err, "could not unmap map before resize").Set("name", m.Name())
 	}
 
 	m.data = data
-	m.id = 0
+
+	return nil
+}
+
+// mmap creates a new mapping of size bytes of the backing file, or anonymous
+// memory if there is none, using the page settings of the map.
+func (m *Map) mmap(size int) ([]byte, error) {
+	align := 0
+	if m.thp {
+		align = m.page
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+
+	if m.file == nil {
+		data, err = mmapAnon(size, m.hugetlb, align)
+	} else {
+		data, err = mmapFile(m.file.Fd(), size, m.write, align)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if m.thp {
+		err = adviseHugePages(data, true)
+		if err != nil {
+			munmap(data)
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+// growSize returns the size to extend a map of the given size to when it needs
+// at least need more bytes. The result is a multiple of page.
+func growSize(size int, need int, page int) int {
+	grown := size * 2
+	if grown < size+need {
+		grown = size + need
+	}
+	return (grown + page - 1) / page * page
+}
+
+// preallocate allocates disk space for a range of file, extending it if
+// necessary. If the file system doesn't support allocation, zeros are written
+// to the range instead.
+func preallocate(file *os.File, offset int64, size int64) error {
+	err := allocate(file, offset, size)
+	if err != errUnsupported {
+		return err
+	}
+
+	zeros := make([]byte, 64*1024)
+	for size > 0 {
+		n := int64(len(zeros))
+		if n > size {
+			n = size
+		}
+
+		_, err = file.WriteAt(zeros[:n], offset)
+		if err != nil {
+			return err
+		}
+
+		offset += n
+		size -= n
+	}
 
 	return nil
 }
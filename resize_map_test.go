@@ -0,0 +1,49 @@
+package mmap
+
+import (
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestPreallocate(t *testing.T) {
+	const size = 1 << 20
+	m, done := tempMap(t, 100, WithPreallocate())
+	defer done()
+
+	if !m.Preallocate() {
+		t.Fatal("WithPreallocate didn't enable preallocation")
+	}
+	if allocated(t, m) < 100 {
+		t.Fatal("initial size wasn't allocated")
+	}
+
+	if err := m.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+	if allocated(t, m) < size {
+		t.Fatal("Truncate didn't allocate the new part of the map")
+	}
+
+	// Without preallocation the file is extended sparsely, if the file system
+	// supports it.
+	m.SetPreallocate(false)
+	if err := m.Truncate(4 * size); err != nil {
+		t.Fatal(err)
+	}
+	if n := allocated(t, m); n >= 4*size {
+		t.Logf("file system allocated %d bytes without preallocation", n)
+	}
+	if m.Size() != 4*size {
+		t.Fatalf("map is %d bytes after Truncate, want %d", m.Size(), 4*size)
+	}
+}
+
+// allocated returns the number of bytes allocated on disk for the map's file.
+func allocated(t *testing.T, m *Map) int64 {
+	info, err := os.Stat(m.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Sys().(*syscall.Stat_t).Blocks * 512
+}
@@ -0,0 +1,155 @@
+package mmap
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// SnapshotMethod is the way Map.Snapshot copied a map.
+type SnapshotMethod int
+
+// Methods used by Map.Snapshot.
+const (
+	SnapshotNone      SnapshotMethod = iota // no snapshot was made
+	SnapshotClone                           // the file was cloned with FICLONE
+	SnapshotCopyRange                       // the file was copied with copy_file_range
+	SnapshotStream                          // the map was written to the new file
+)
+
+func (s SnapshotMethod) String() string {
+	switch s {
+	case SnapshotNone:
+		return "none"
+	case SnapshotClone:
+		return "clone"
+	case SnapshotCopyRange:
+		return "copy_file_range"
+	case SnapshotStream:
+		return "stream"
+	default:
+		return "unknown"
+	}
+}
+
+// Snapshot copies the map to a new file dest, which must not exist, and reports
+// how it was copied, or SnapshotNone with an error if it wasn't. The map is
+// synced first, then the file is cloned if the file system supports it, which
+// is fast and shares the disk blocks until either file changes. Otherwise it is
+// copied with copy_file_range, or as a last resort written out from the map,
+// which is also how anonymous maps are copied. The new file is synced to disk
+// before Snapshot returns.
+//
+// Writers are blocked while the data is copied, so the snapshot doesn't see
+// half of a write, but not while the new file is created and synced. Changes
+// made through Direct slices are not blocked. Copying the map is only fast
+// when the file is cloned; the other methods block Writers for as long as it
+// takes to copy all of it.
+func (m *Map) Snapshot(dest string) (SnapshotMethod, error) {
+	mode, err := m.snapshotMode()
+	if err != nil {
+		return SnapshotNone, err
+	}
+
+	file, err := os.OpenFile(dest, os.O_RDWR|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return SnapshotNone, errors.Wrap(err, "could not create snapshot").Set("name", m.Name()).
+			Set("dest", dest)
+	}
+
+	method, err := m.snapshot(file)
+	if err == nil {
+		err = file.Sync()
+		if err != nil {
+			err = errors.Wrap(err, "could not sync snapshot").Set("name", m.Name()).
+				Set("dest", dest)
+		}
+	}
+	if err == nil && m.durable {
+		err = syncDir(filepath.Dir(dest))
+		if err != nil {
+			err = errors.Wrap(err, "could not sync directory").Set("name", m.Name()).
+				Set("dest", dest)
+		}
+	}
+
+	cerr := file.Close()
+	if cerr != nil && err == nil {
+		err = errors.Wrap(cerr, "error closing snapshot").Set("name", m.Name()).
+			Set("dest", dest)
+	}
+
+	if err != nil {
+		os.Remove(dest)
+		return SnapshotNone, err
+	}
+
+	return method, nil
+}
+
+// snapshotMode returns the permissions for a snapshot of the map, which are
+// the same as the file's.
+func (m *Map) snapshotMode() (os.FileMode, error) {
+	m.rlock()
+	defer m.RUnlock()
+
+	if m.data == nil {
+		return 0, errors.New("mmap closed").Set("name", m.Name())
+	}
+
+	if m.file == nil {
+		return 0600, nil
+	}
+
+	info, err := m.file.Stat()
+	if err != nil {
+		return 0, errors.Wrap(err, "could not stat file").Set("name", m.Name())
+	}
+	return info.Mode().Perm(), nil
+}
+
+// snapshot copies the map to file, trying each method in turn.
+func (m *Map) snapshot(file *os.File) (SnapshotMethod, error) {
+	m.rlock()
+	defer m.RUnlock()
+
+	if m.data == nil {
+		return SnapshotNone, errors.New("mmap closed").Set("name", m.Name())
+	}
+	size := int64(len(m.data))
+
+	if m.file != nil {
+		if m.write {
+			err := m.msync(m.data, true)
+			if err != nil {
+				return SnapshotNone, errors.Wrap(err, "could not sync map before snapshot").
+					Set("name", m.Name())
+			}
+		}
+
+		info, err := m.file.Stat()
+		if err == nil && info.Size() == size && cloneFile(file, m.file) == nil {
+			return SnapshotClone, nil
+		}
+
+		if copyFileRange(file, m.file, size) == nil {
+			return SnapshotCopyRange, nil
+		}
+
+		err = file.Truncate(0)
+		if err != nil {
+			return SnapshotNone, errors.Wrap(err, "could not reset snapshot").Set("name", m.Name())
+		}
+	}
+
+	err := m.checkProtect(0, len(m.data), false)
+	if err != nil {
+		return SnapshotNone, errors.Wrap(err, "cannot snapshot protected map").Set("name", m.Name())
+	}
+
+	_, err = file.WriteAt(m.data, 0)
+	if err != nil {
+		return SnapshotNone, errors.Wrap(err, "could not write snapshot").Set("name", m.Name())
+	}
+
+	return SnapshotStream, nil
+}
@@ -0,0 +1,137 @@
+package mmap
+
+import (
+	"os"
+	"sync/atomic"
+	"unsafe"
+)
+
+// snapshot is the frozen view of a map read by a snapshot Reader. It is a
+// private mapping of the backing file, so the kernel copies a page of it the
+// first time it is written. Writing each page to itself before the map changes
+// it keeps the old contents, while unchanged pages are shared with the map.
+// Slices borrowed from it are leases that keep it mapped after its Reader is
+// closed.
+type snapshot struct {
+	data   []byte
+	copied []uint64
+	leases int
+	closed bool
+}
+
+// SnapshotReader returns a new Reader with a consistent view of the map as it
+// is now. Changes made later through Writers and the other methods of the map
+// are not visible to it, and Writers don't wait for it. Each page is copied
+// just before it is first changed, so a snapshot uses memory for the pages
+// changed while it is open. Changes to the file made by other processes are
+// not frozen. Like other Readers, it is closed by Truncate and Close. Slices
+// borrowed from it stay valid until they are released, even if it is closed.
+func (m *Map) SnapshotReader() (*Reader, error) {
+	m.lock()
+	defer m.Unlock()
+
+	if m.data == nil {
+		return nil, errors.New("mmap closed").Set("name", m.Name())
+	}
+
+	if m.file == nil {
+		return nil, errors.New("cannot snapshot anonymous map").Set("name", m.Name())
+	}
+
+	if len(m.direct) > 0 {
+		return nil, errors.New("mmap has open direct access pointers").Set("name", m.Name())
+	}
+
+	data, err := mmapPrivate(m.file.Fd(), len(m.data))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not map snapshot").Set("name", m.Name())
+	}
+
+	pages := (len(data) + os.Getpagesize() - 1) / os.Getpagesize()
+
+	id := m.id
+	m.id++
+
+	reader := &Reader{
+		Map: m,
+		id:  id,
+		snap: &snapshot{
+			data:   data,
+			copied: make([]uint64, (pages+63)/64),
+		},
+	}
+
+	if m.snaps == nil {
+		m.snaps = make(map[int]*snapshot)
+	}
+	m.snaps[id] = reader.snap
+
+	// Parts that Writer.ReadFrom is reading into are changed after this.
+	for _, w := range m.writers {
+		if w.fillStart < w.fillEnd {
+			reader.snap.preserve(w.fillStart, w.fillEnd-w.fillStart)
+		}
+	}
+
+	m.readers[id] = reader
+	atomic.AddInt64(&m.stats.readers, 1)
+	m.hookAccessor(ReaderAccessor, true)
+
+	return reader, nil
+}
+
+// closeSnapshot releases the snapshot of the Reader, or marks it closed if
+// borrowed slices of it are still held. Lock the map before calling.
+func (r *Reader) closeSnapshot() {
+	r.snap.closed = true
+	if r.snap.leases == 0 {
+		r.freeSnapshot(r.id, r.snap)
+	}
+}
+
+// releaseSnapshot removes a lease from the snapshot of the Reader with the
+// given id, freeing it if it is closed and that was the last one.
+// Lock the map before calling.
+func (m *Map) releaseSnapshot(id int, s *snapshot) {
+	s.leases--
+	if s.closed && s.leases == 0 {
+		m.freeSnapshot(id, s)
+	}
+}
+
+// freeSnapshot stops preserving the snapshot of the Reader with the given id
+// and unmaps it. Lock the map before calling.
+func (m *Map) freeSnapshot(id int, s *snapshot) {
+	delete(m.snaps, id)
+	munmap(s.data)
+	s.data = nil
+}
+
+// preserve keeps the current contents of the part of the map between offset
+// and offset+size in every open snapshot before it is changed.
+// Lock the map before calling.
+func (m *Map) preserve(offset int, size int) {
+	for _, s := range m.snaps {
+		s.preserve(offset, size)
+	}
+}
+
+func (s *snapshot) preserve(offset int, size int) {
+	page := os.Getpagesize()
+
+	end := offset + size
+	if end > len(s.data) {
+		end = len(s.data)
+	}
+
+	for p := offset / page; p*page < end; p++ {
+		bit := uint64(1) << uint(p%64)
+		if s.copied[p/64]&bit != 0 {
+			continue
+		}
+		s.copied[p/64] |= bit
+
+		// Adding zero writes the page without changing it.
+		atomic.AddUint32((*uint32)(unsafe.Pointer(&s.data[p*page])), 0)
+	}
+}
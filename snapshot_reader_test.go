@@ -0,0 +1,72 @@
+package mmap
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestSnapshotReader(t *testing.T) {
+	page := os.Getpagesize()
+	m, done := tempMap(t, 2*page)
+	defer done()
+
+	old := bytes.Repeat([]byte("a"), 2*page)
+	w, _ := m.Writer()
+	w.Write(old)
+
+	s, err := m.SnapshotReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w.WriteAt([]byte("bbbb"), int64(page))
+	w.Fill(0, 10, 'c')
+
+	b, err := ioutil.ReadAll(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, old) {
+		t.Fatal("snapshot sees later writes")
+	}
+
+	s.Close()
+	if len(m.snaps) != 0 {
+		t.Fatal("snapshot not freed when closed")
+	}
+
+	s, _ = m.SnapshotReader()
+	m.Truncate(int64(page))
+	if _, err := s.Read(make([]byte, 1)); err == nil {
+		t.Fatal("snapshot readable after Truncate")
+	}
+}
+
+func TestSnapshotBorrowClose(t *testing.T) {
+	page := os.Getpagesize()
+	m, done := tempMap(t, page)
+	defer done()
+
+	w, _ := m.Writer()
+	w.Write([]byte("before"))
+
+	s, _ := m.SnapshotReader()
+	b, release, err := s.Borrow(0, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Close()
+	w.WriteAt([]byte("after!"), 0)
+
+	if string(b) != "before" {
+		t.Fatalf("borrowed %q from closed snapshot, want %q", b, "before")
+	}
+
+	release()
+	if len(m.snaps) != 0 {
+		t.Fatal("snapshot not freed after release")
+	}
+}
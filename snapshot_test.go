@@ -0,0 +1,76 @@
+package mmap
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	page := os.Getpagesize()
+	m, done := tempMap(t, 2*page)
+	defer done()
+
+	data := bytes.Repeat([]byte("snapshot"), page/4)
+	w, _ := m.Writer()
+	w.Write(data)
+
+	dir := filepath.Dir(m.Name())
+
+	// Whether the file can be cloned depends on the file system, but it's
+	// never streamed from the map.
+	method, err := m.Snapshot(filepath.Join(dir, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method != SnapshotClone && method != SnapshotCopyRange {
+		t.Fatalf("file map copied with %v", method)
+	}
+	checkSnapshot(t, filepath.Join(dir, "file"), data)
+
+	// An existing file isn't replaced.
+	method, err = m.Snapshot(filepath.Join(dir, "file"))
+	if method != SnapshotNone || err == nil {
+		t.Fatalf("Snapshot over a file returned %v, %v, want none and an error", method, err)
+	}
+
+	a, err := Anonymous(2*page, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	w, _ = a.Writer()
+	w.Write(data)
+
+	method, err = a.Snapshot(filepath.Join(dir, "anon"))
+	if method != SnapshotStream || err != nil {
+		t.Fatalf("Snapshot of anonymous map returned %v, %v, want stream, nil", method, err)
+	}
+	checkSnapshot(t, filepath.Join(dir, "anon"), data)
+
+	// A map that can't be read can't be streamed, and nothing is left behind.
+	if err := a.Protect(page, page, ProtectNone); err != nil {
+		t.Fatal(err)
+	}
+	method, err = a.Snapshot(filepath.Join(dir, "protected"))
+	if method != SnapshotNone || err == nil {
+		t.Fatalf("Snapshot of protected map returned %v, %v, want none and an error", method, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "protected")); !os.IsNotExist(err) {
+		t.Fatal("failed snapshot was not removed:", err)
+	}
+}
+
+// checkSnapshot fails the test if the file name doesn't start with data.
+func checkSnapshot(t *testing.T, name string, data []byte) {
+	got, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(got, data) {
+		t.Fatalf("snapshot %s has the wrong contents", filepath.Base(name))
+	}
+}
@@ -0,0 +1,138 @@
+package mmap
+
+// Extent is a region of the backing file reported by Map.Extents.
+type Extent struct {
+	Offset int  // offset of the region in the file
+	Length int  // length of the region in bytes
+	Hole   bool // the region is a hole with no allocated blocks
+}
+
+// PunchHole deallocates the blocks backing a region of the map. The region
+// reads as zeros afterward and no longer uses space on disk. Like a write, it
+// fails if the region is protected.
+func (m *Map) PunchHole(offset int, size int) error {
+	m.lock()
+	defer m.Unlock()
+
+	if !m.write {
+		return errors.New("cannot punch hole in read-only map").Set("name", m.Name())
+	}
+
+	if m.data == nil {
+		return errors.New("mmap closed").Set("name", m.Name())
+	}
+
+	if m.file == nil {
+		return errors.New("anonymous map has no backing file").Set("name", m.Name())
+	}
+
+	err := m.checkRegion(offset, size)
+	if err != nil {
+		return err
+	}
+
+	err = m.checkProtect(offset, size, true)
+	if err != nil {
+		return err
+	}
+
+	m.preserve(offset, size)
+
+	err = punchHole(m.file, int64(offset), int64(size))
+	if err != nil {
+		return errors.Wrap(err, "could not punch hole").Set("name", m.Name()).
+			Set("offset", offset).Set("size", size)
+	}
+
+	return nil
+}
+
+// Allocate reserves blocks on disk for a region of the map, so that later writes
+// to it can't fail because the disk is full.
+func (m *Map) Allocate(offset int, size int) error {
+	m.lock()
+	defer m.Unlock()
+
+	if !m.write {
+		return errors.New("cannot allocate read-only map").Set("name", m.Name())
+	}
+
+	if m.data == nil {
+		return errors.New("mmap closed").Set("name", m.Name())
+	}
+
+	if m.file == nil {
+		return errors.New("anonymous map has no backing file").Set("name", m.Name())
+	}
+
+	err := m.checkRegion(offset, size)
+	if err != nil {
+		return err
+	}
+
+	err = allocate(m.file, int64(offset), int64(size))
+	if err != nil {
+		return errors.Wrap(err, "could not allocate").Set("name", m.Name()).
+			Set("offset", offset).Set("size", size)
+	}
+
+	return nil
+}
+
+// Extents reports the data and hole regions of the map in order. On file systems
+// that don't support sparse files the whole map is reported as data.
+func (m *Map) Extents() ([]Extent, error) {
+	m.rlock()
+	defer m.RUnlock()
+
+	if m.data == nil {
+		return nil, errors.New("mmap closed").Set("name", m.Name())
+	}
+
+	if m.file == nil {
+		return []Extent{{Length: len(m.data)}}, nil
+	}
+
+	var (
+		extents []Extent
+		size    = int64(len(m.data))
+		offset  int64
+	)
+
+	for offset < size {
+		data, err := seekData(m.file, offset)
+		if err == errENXIO {
+			data = size
+		} else if err != nil {
+			return nil, errors.Wrap(err, "could not seek to data").
+				Set("name", m.Name()).Set("offset", offset)
+		}
+
+		if data > size {
+			data = size
+		}
+
+		if offset < data {
+			extents = append(extents, Extent{Offset: int(offset), Length: int(data - offset), Hole: true})
+		}
+
+		if data == size {
+			break
+		}
+
+		hole, err := seekHole(m.file, data)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not seek to hole").
+				Set("name", m.Name()).Set("offset", data)
+		}
+
+		if hole > size {
+			hole = size
+		}
+
+		extents = append(extents, Extent{Offset: int(data), Length: int(hole - data)})
+		offset = hole
+	}
+
+	return extents, nil
+}
@@ -0,0 +1,81 @@
+package mmap
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSparse(t *testing.T) {
+	const size = 1 << 20
+	m, done := tempMap(t, size)
+	defer done()
+
+	if err := m.Allocate(0, size); err != nil {
+		t.Skip("file system doesn't support fallocate:", err)
+	}
+
+	w, _ := m.Writer()
+	w.Fill(0, size, 1)
+	m.Sync(true)
+
+	start, n := 64<<10, 128<<10
+	if err := m.PunchHole(start, n); err != nil {
+		t.Skip("file system doesn't support punching holes:", err)
+	}
+
+	b := make([]byte, size)
+	w.ReadAt(b, 0)
+	want := bytes.Repeat([]byte{1}, size)
+	copy(want[start:start+n], make([]byte, n))
+	if !bytes.Equal(b, want) {
+		t.Fatal("PunchHole zeroed the wrong bytes")
+	}
+
+	extents, err := m.Extents()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The extents cover the map in order, and the hole is reported if the file
+	// system supports it.
+	end, holes := 0, 0
+	for _, e := range extents {
+		if e.Offset != end || e.Length < 1 {
+			t.Fatalf("extents %+v don't cover the map", extents)
+		}
+		end += e.Length
+		if e.Hole {
+			holes++
+			if e.Offset > start || e.Offset+e.Length < start+n {
+				t.Fatalf("hole %+v doesn't cover the punched region", e)
+			}
+		}
+	}
+	if end != size || holes > 1 {
+		t.Fatalf("extents %+v don't match the map", extents)
+	}
+
+	if err := m.PunchHole(size-10, 20); err == nil {
+		t.Fatal("PunchHole past the end of the map succeeded")
+	}
+	if err := m.Protect(0, 4096, ProtectRead); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.PunchHole(0, 100); err == nil {
+		t.Fatal("PunchHole in a protected region succeeded")
+	}
+
+	a, err := Anonymous(100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	if err := a.PunchHole(0, 10); err == nil {
+		t.Fatal("PunchHole in an anonymous map succeeded")
+	}
+	extents, err = a.Extents()
+	if err != nil || len(extents) != 1 || extents[0] != (Extent{Length: 100}) {
+		t.Fatalf("Extents of an anonymous map returned %+v, %v", extents, err)
+	}
+}
@@ -0,0 +1,164 @@
+package mmap
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// syncBounds are the upper bounds of the sync latency histogram buckets.
+var syncBounds = []time.Duration{
+	10 * time.Microsecond,
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+}
+
+// Stats is a snapshot of the activity of a Map since it was opened.
+type Stats struct {
+	Readers int // open Readers
+	Writers int // open Writers
+	Directs int // open Direct slices
+
+	ReadersCreated int64 // Readers created
+	WritersCreated int64 // Writers created
+	DirectsCreated int64 // Direct slices created
+
+	BytesRead    int64 // bytes read through Readers
+	BytesWritten int64 // bytes written through Writers
+
+	Syncs       int64     // calls to msync
+	SyncLatency Histogram // duration of calls to msync
+
+	Truncates int64         // times the map was resized
+	LockWait  time.Duration // time spent waiting to lock the map, see SetLockStats
+
+	// Page faults of the whole process since the map was opened.
+	MinorFaults int64
+	MajorFaults int64
+}
+
+// Histogram is a distribution of durations. Counts[i] is the number of
+// durations less than or equal to Bounds[i] and greater than the previous
+// bound. The last count is for durations greater than every bound.
+type Histogram struct {
+	Bounds []time.Duration
+	Counts []int64
+	Count  int64
+	Sum    time.Duration
+}
+
+// stats holds the counters of a Map. They are updated atomically, so the map
+// doesn't have to be locked.
+type stats struct {
+	readers  int64
+	writers  int64
+	directs  int64
+	read     int64
+	written  int64
+	syncs    int64
+	syncSum  int64
+	syncHist []int64
+	resizes  int64
+	lockWait int64
+	minflt   int64
+	majflt   int64
+	timeLock int32
+}
+
+func newStats() *stats {
+	s := &stats{syncHist: make([]int64, len(syncBounds)+1)}
+	s.minflt, s.majflt = pageFaults()
+	return s
+}
+
+func (s *stats) addRead(n int) {
+	atomic.AddInt64(&s.read, int64(n))
+}
+
+func (s *stats) addWritten(n int) {
+	atomic.AddInt64(&s.written, int64(n))
+}
+
+func (s *stats) addSync(d time.Duration) {
+	i := 0
+	for i < len(syncBounds) && d > syncBounds[i] {
+		i++
+	}
+	atomic.AddInt64(&s.syncHist[i], 1)
+	atomic.AddInt64(&s.syncSum, int64(d))
+	atomic.AddInt64(&s.syncs, 1)
+}
+
+// Stats returns a snapshot of the activity of the map.
+func (m *Map) Stats() Stats {
+	m.rlock()
+	readers, writers, directs := len(m.readers), len(m.writers), len(m.direct)
+	m.RUnlock()
+
+	s := m.stats
+	minflt, majflt := pageFaults()
+
+	hist := Histogram{
+		Bounds: append([]time.Duration(nil), syncBounds...),
+		Counts: make([]int64, len(s.syncHist)),
+		Sum:    time.Duration(atomic.LoadInt64(&s.syncSum)),
+	}
+	for i := range s.syncHist {
+		hist.Counts[i] = atomic.LoadInt64(&s.syncHist[i])
+		hist.Count += hist.Counts[i]
+	}
+
+	return Stats{
+		Readers:        readers,
+		Writers:        writers,
+		Directs:        directs,
+		ReadersCreated: atomic.LoadInt64(&s.readers),
+		WritersCreated: atomic.LoadInt64(&s.writers),
+		DirectsCreated: atomic.LoadInt64(&s.directs),
+		BytesRead:      atomic.LoadInt64(&s.read),
+		BytesWritten:   atomic.LoadInt64(&s.written),
+		Syncs:          atomic.LoadInt64(&s.syncs),
+		SyncLatency:    hist,
+		Truncates:      atomic.LoadInt64(&s.resizes),
+		LockWait:       time.Duration(atomic.LoadInt64(&s.lockWait)),
+		MinorFaults:    minflt - s.minflt,
+		MajorFaults:    majflt - s.majflt,
+	}
+}
+
+// SetLockStats enables measuring how long the map waits to be locked, which is
+// reported as Stats.LockWait. It is disabled by default, because timing every
+// lock slows down small reads and writes.
+func (m *Map) SetLockStats(enable bool) {
+	var timeLock int32
+	if enable {
+		timeLock = 1
+	}
+	atomic.StoreInt32(&m.stats.timeLock, timeLock)
+}
+
+// lock locks the map for writing and records how long it waited, if enabled.
+func (m *Map) lock() {
+	if atomic.LoadInt32(&m.stats.timeLock) == 0 {
+		m.Lock()
+		return
+	}
+
+	start := time.Now()
+	m.Lock()
+	atomic.AddInt64(&m.stats.lockWait, int64(time.Since(start)))
+}
+
+// rlock locks the map for reading and records how long it waited, if enabled.
+func (m *Map) rlock() {
+	if atomic.LoadInt32(&m.stats.timeLock) == 0 {
+		m.RLock()
+		return
+	}
+
+	start := time.Now()
+	m.RLock()
+	atomic.AddInt64(&m.stats.lockWait, int64(time.Since(start)))
+}
@@ -0,0 +1,61 @@
+package mmap
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	m, done := tempMap(t, 100, WithSyncPolicy(SyncOnWrite))
+	defer done()
+
+	w, _ := m.Writer()
+	w.WriteString("hello")
+	r, _ := m.Reader()
+	r.Read(make([]byte, 3))
+	w.Close()
+
+	s := m.Stats()
+	if s.Readers != 1 || s.Writers != 0 || s.Directs != 0 {
+		t.Fatalf("Stats reported %d readers, %d writers and %d directs, want 1, 0 and 0", s.Readers, s.Writers, s.Directs)
+	}
+	r.Close()
+
+	d, err := m.Direct()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s = m.Stats(); s.Readers != 0 || s.Directs != 1 {
+		t.Fatalf("Stats reported %d readers and %d directs, want 0 and 1", s.Readers, s.Directs)
+	}
+	m.Free(d)
+
+	m.Truncate(8192)
+
+	s = m.Stats()
+	if s.ReadersCreated != 1 || s.WritersCreated != 1 || s.DirectsCreated != 1 {
+		t.Fatalf("Stats reported %+v, want one of each accessor created", s)
+	}
+	if s.BytesWritten != 5 || s.BytesRead != 3 || s.Truncates != 1 {
+		t.Fatalf("Stats reported %+v, want 5 bytes written, 3 read and 1 truncate", s)
+	}
+	if s.Syncs < 2 || s.SyncLatency.Count != s.Syncs || len(s.SyncLatency.Counts) != len(s.SyncLatency.Bounds)+1 {
+		t.Fatalf("Stats reported %d syncs and latency %+v", s.Syncs, s.SyncLatency)
+	}
+	if s.LockWait != 0 {
+		t.Fatal("lock wait was timed without SetLockStats")
+	}
+
+	// Wait for a lock held by another goroutine.
+	m.SetLockStats(true)
+	m.lock()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		m.Unlock()
+	}()
+	m.Size()
+
+	if s = m.Stats(); s.LockWait < 10*time.Millisecond {
+		t.Fatalf("Stats reported %v waiting for the lock, want at least 10ms", s.LockWait)
+	}
+}
@@ -1,17 +1,23 @@
 package mmap
 
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
 // Sync flushes all changes to the map out to the backing file.
 func (m *Map) Sync(wait bool) error {
+	m.lock()
+	defer m.Unlock()
+
 	if !m.write {
-		return errors.New("cannot sync read-only map").Set("name", m.name)
+		return errors.New("cannot sync read-only map").Set("name", m.Name())
 	}
 
-	m.Lock()
-	defer m.Unlock()
-
 	err := m.sync(wait)
 	if err != nil {
-		return errors.Wrap(err, "error syncing map").Set("name", m.name)
+		return errors.Wrap(err, "error syncing map").Set("name", m.Name())
 	}
 
 	return nil
@@ -22,5 +28,57 @@ func (m *Map) sync(wait bool) error {
 	if m.data == nil {
 		return errors.New("mmap closed")
 	}
-	return msync(m.data, wait)
+	return m.msync(m.data, wait)
+}
+
+// msync flushes data, which is part of the map, records the call and calls
+// the Sync hook. Lock the map before calling.
+func (m *Map) msync(data []byte, wait bool) error {
+	start := time.Now()
+	err := msync(data, wait)
+	duration := time.Since(start)
+
+	m.stats.addSync(duration)
+
+	if m.hooks != nil {
+		m.hookError("sync", err)
+		if m.hooks.Sync != nil && len(data) > 0 {
+			offset := int(dataAddr(data) - dataAddr(m.data))
+			m.hooks.Sync(m.Name(), offset, len(data), duration, err)
+		}
+	}
+
+	return err
+}
+
+// syncFile flushes the data and size of the backing file to disk, and the
+// entries of its directory if dir is set. Lock the map before calling.
+func (m *Map) syncFile(dir bool) error {
+	err := fdatasync(m.file)
+	if err != nil {
+		return errors.Wrap(err, "could not sync file").Set("name", m.Name())
+	}
+
+	if dir {
+		err = syncDir(filepath.Dir(m.Name()))
+		if err != nil {
+			return errors.Wrap(err, "could not sync directory").Set("name", m.Name())
+		}
+	}
+
+	return nil
+}
+
+// syncRange flushes the pages of the map that contain the given range.
+// Lock the map and check that it is open before calling.
+func (m *Map) syncRange(offset int, size int) error {
+	page := os.Getpagesize()
+	start := offset / page * page
+
+	end := offset + size
+	if end > len(m.data) {
+		end = len(m.data)
+	}
+
+	return m.msync(m.data[start:end], true)
 }
@@ -0,0 +1,301 @@
+package mmap
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// Watcher keeps a read-only map of a file up to date while another process
+// changes it. When the file is replaced, for example by renaming a new file over
+// it, or its size changes, the file is mapped again and the new map is returned
+// by later calls to Map, while users of the old map can finish with it. If the
+// file shrinks in place, reading the old map past the new end of the file raises
+// SIGBUS, as with any map of a file truncated by another process. Each Map must
+// be paired with a Release, and the maps must not be closed directly.
+//
+// Watching uses inotify and is only available on Linux.
+type Watcher struct {
+	mu      sync.Mutex
+	path    string
+	opts    []Option
+	notify  func(m *Map, err error)
+	current *Map
+	refs    map[*Map]int
+	closed  bool
+	n       *notifier
+	done    chan struct{}
+}
+
+// Watch opens the file name read-only with opts and watches it for changes.
+// If notify is not nil, it is called after the file is remapped with the map
+// that is now current, or with an error if remapping failed. It is called from
+// a separate goroutine and may call methods of the Watcher.
+func Watch(name string, notify func(m *Map, err error), opts ...Option) (*Watcher, error) {
+	path, err := filepath.Abs(name)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not resolve path").Set("name", name)
+	}
+
+	opts = append(opts[:len(opts):len(opts)], WithReadOnly())
+
+	m, err := OpenWith(path, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := newNotifier(filepath.Dir(path))
+	if err != nil {
+		m.Close()
+		return nil, errors.Wrap(err, "could not watch file").Set("name", name)
+	}
+
+	w := &Watcher{
+		path:    path,
+		opts:    opts,
+		notify:  notify,
+		current: m,
+		refs:    make(map[*Map]int),
+		n:       n,
+		done:    make(chan struct{}),
+	}
+
+	go w.run()
+
+	return w, nil
+}
+
+// Map returns the current map of the file. Release it when done with it.
+func (w *Watcher) Map() (*Map, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil, errors.New("watcher closed").Set("name", w.path)
+	}
+
+	w.refs[w.current]++
+
+	return w.current, nil
+}
+
+// Release gives up a map returned by Map. A map that has been replaced is
+// closed when its last user releases it, and the error from closing it is
+// returned.
+func (w *Watcher) Release(m *Map) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.refs[m] < 1 {
+		return errors.New("map not from watcher").Set("name", w.path)
+	}
+
+	w.refs[m]--
+	if w.refs[m] > 0 {
+		return nil
+	}
+	delete(w.refs, m)
+
+	if m != w.current || w.closed {
+		return m.Close()
+	}
+
+	return nil
+}
+
+// Close stops watching the file. The current map is closed once it has been
+// released.
+func (w *Watcher) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	w.n.stop()
+	<-w.done
+	err := w.n.close()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.refs[w.current] == 0 {
+		cerr := w.current.Close()
+		if cerr != nil {
+			err = cerr
+		}
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "error closing watcher").Set("name", w.path)
+	}
+
+	return nil
+}
+
+// run remaps the file whenever it changes, until the watcher is closed.
+func (w *Watcher) run() {
+	defer close(w.done)
+
+	base := filepath.Base(w.path)
+
+	for {
+		names, err := w.n.wait()
+		if err != nil {
+			w.report(nil, errors.Wrap(err, "error watching file").Set("name", w.path))
+			return
+		}
+		if names == nil {
+			return
+		}
+
+		for _, name := range names {
+			if name == base {
+				w.report(w.refresh())
+				break
+			}
+		}
+	}
+}
+
+// report calls the notify callback unless there is nothing to report.
+func (w *Watcher) report(m *Map, err error) {
+	if w.notify != nil && (m != nil || err != nil) {
+		w.notify(m, err)
+	}
+}
+
+// refresh maps the file again if it has been replaced or resized. It returns
+// the current map if it changed. The old map is never resized in place, since
+// its users may be reading past the new end of the file.
+func (w *Watcher) refresh() (*Map, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil, nil
+	}
+
+	info, err := os.Stat(w.path)
+	if os.IsNotExist(err) {
+		// Keep serving the old file until a new one is moved into place.
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "could not stat file").Set("name", w.path)
+	}
+
+	cur := w.current
+	cur.rlock()
+	same := os.SameFile(info, statFile(cur.file)) && info.Size() == int64(len(cur.data))
+	cur.RUnlock()
+
+	if same {
+		return nil, nil
+	}
+
+	m, err := OpenWith(w.path, w.opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	w.current = m
+	if w.refs[cur] == 0 {
+		cur.Close()
+	}
+
+	return m, nil
+}
+
+// statFile returns information about file, or nil if it can't be read.
+func statFile(file *os.File) os.FileInfo {
+	info, err := file.Stat()
+	if err != nil {
+		return nil
+	}
+	return info
+}
+
+// Reload maps the backing file again if another process has changed its size.
+// It reports whether the size of the map changed. Readers and Writers keep their
+// offsets, but open Direct slices are closed. The map isn't resized beyond
+// address space reserved with Reserve.
+func (m *Map) Reload() (bool, error) {
+	m.lock()
+	defer m.Unlock()
+
+	if m.data == nil {
+		return false, errors.New("mmap closed").Set("name", m.Name())
+	}
+
+	if m.file == nil {
+		return false, errors.New("cannot reload anonymous map").Set("name", m.Name())
+	}
+
+	info, err := m.file.Stat()
+	if err != nil {
+		return false, errors.Wrap(err, "could not stat file").Set("name", m.Name())
+	}
+
+	size := int(info.Size())
+	if info.Size() != int64(size) {
+		return false, errors.New("file too large for architecture").Set("name", m.Name()).
+			Set("size", info.Size())
+	}
+
+	if size == len(m.data) || size < 1 {
+		return false, nil
+	}
+
+	err = m.checkLeases()
+	if err != nil {
+		return false, errors.Wrap(err, "cannot reload map").Set("name", m.Name())
+	}
+
+	m.closeDirects()
+
+	err = m.reload(size)
+	if err != nil {
+		return false, errors.Wrap(err, "could not reload map").Set("name", m.Name()).
+			Set("size", size)
+	}
+
+	atomic.AddInt64(&m.stats.resizes, 1)
+
+	return true, m.remapped()
+}
+
+// reload replaces the mapping with one of size bytes of the backing file,
+// without changing the file. Lock the map before calling.
+func (m *Map) reload(size int) error {
+	if m.reserve != nil {
+		if size > len(m.reserve) {
+			size = len(m.reserve)
+		}
+
+		err := m.mapFixed(m.reserve, 0, size)
+		if err != nil {
+			return err
+		}
+
+		m.data = m.reserve[:size:size]
+		return nil
+	}
+
+	err := m.unmap()
+	if err != nil {
+		return err
+	}
+
+	data, err := m.mmap(size)
+	if err != nil {
+		return err
+	}
+
+	m.data = data
+
+	return nil
+}
@@ -0,0 +1,107 @@
+//go:build linux
+// +build linux
+
+package mmap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "map")
+	ioutil.WriteFile(name, []byte("one"), 0600)
+
+	maps := make(chan *Map, 10)
+	w, err := Watch(name, func(m *Map, err error) {
+		if err != nil {
+			t.Error(err)
+		}
+		maps <- m
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := func(old *Map) *Map {
+		for {
+			select {
+			case m := <-maps:
+				if m != old {
+					return m
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("no notification")
+			}
+		}
+	}
+
+	first, _ := w.Map()
+	r, _ := first.Reader()
+
+	// Growing the file maps it again, and the old map is unchanged.
+	f, _ := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0)
+	f.Write([]byte("two"))
+	f.Close()
+
+	grown := next(first)
+	if grown == first || grown.Size() != 6 {
+		t.Fatalf("file mapped again with %d bytes, want a new map of 6", grown.Size())
+	}
+	if first.Size() != 3 {
+		t.Fatalf("old map resized to %d bytes", first.Size())
+	}
+
+	b, _ := ioutil.ReadAll(r)
+	if string(b) != "one" {
+		t.Fatalf("old Reader read %q, want %q", b, "one")
+	}
+
+	if m, _ := w.Map(); m != grown {
+		t.Fatal("Map didn't return the new map")
+	} else {
+		w.Release(m)
+	}
+
+	w.Release(first)
+	if !first.Closed() {
+		t.Fatal("old map not closed when released")
+	}
+
+	// Replacing the file maps the new one.
+	second, _ := w.Map()
+
+	tmp := filepath.Join(dir, "tmp")
+	ioutil.WriteFile(tmp, []byte("three"), 0600)
+	os.Rename(tmp, name)
+
+	replaced := next(second)
+	if replaced.Size() != 5 || second.Closed() {
+		t.Fatal("file not replaced or old map closed while in use")
+	}
+
+	w.Release(second)
+	if !second.Closed() {
+		t.Fatal("replaced map not closed when released")
+	}
+
+	third, _ := w.Map()
+	w.Close()
+	if third.Closed() {
+		t.Fatal("map closed while in use")
+	}
+
+	w.Release(third)
+	if !third.Closed() {
+		t.Fatal("map not closed when released after Close")
+	}
+}
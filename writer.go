@@ -2,14 +2,19 @@ package mmap
 
 import (
 	"io"
+	"sync/atomic"
 )
 
+// fillChunk is the most ReadFrom lets its source read into the map at once.
+const fillChunk = 64 * 1024
+
 // Writer reads from and writes to a map. In addition to the methods of mmap.Reader,
 // it also implements the following interfaces from the io standard package:
 //
 //     - Writer          (Write)
 //     - WriterAt        (WriteAt)
 //     - ByteWriter      (WriteByte)
+//     - ReaderFrom      (ReadFrom)
 //     - WriteSeeker     (Write, Seek)
 //     - WriteCloser     (Write, Close)
 //     - ReadWriter      (Read, Write)
@@ -17,11 +22,13 @@ import (
 //     - ReadWriteCloser (Read, Write, Close)
 type Writer struct {
 	*Reader
+	fillStart int // the part of the map ReadFrom is reading into
+	fillEnd   int
 }
 
 // Writer returns a new Writer for the map.
 func (m *Map) Writer() (*Writer, error) {
-	m.Lock()
+	m.lock()
 	defer m.Unlock()
 
 	if m.data == nil {
@@ -47,37 +54,96 @@ func (m *Map) Writer() (*Writer, error) {
 	}
 
 	m.writers[id] = writer
+	atomic.AddInt64(&m.stats.writers, 1)
+	m.hookAccessor(WriterAccessor, true)
+
+	return writer, nil
+}
+
+// SectionWriter returns a new Writer bound to the region of the map specified
+// by offset and size. Its offsets, Seek and io.EOF are relative to that region
+// and it cannot read or write outside of it.
+func (m *Map) SectionWriter(offset int, size int) (*Writer, error) {
+	m.lock()
+	defer m.Unlock()
+
+	if m.data == nil {
+		return nil, errors.New("mmap closed").Set("name", m.Name())
+	}
+
+	if !m.write {
+		return nil, errors.New("mmap not opened for writing").Set("name", m.Name())
+	}
+
+	if len(m.direct) > 0 {
+		return nil, errors.New("mmap has open direct access pointers").Set("name", m.Name())
+	}
+
+	err := m.checkRegion(offset, size)
+	if err != nil {
+		return nil, err
+	}
+
+	id := m.id
+	m.id++
+
+	writer := &Writer{
+		Reader: &Reader{
+			Map:     m,
+			id:      id,
+			section: true,
+			base:    offset,
+			size:    size,
+		},
+	}
+
+	m.writers[id] = writer
+	atomic.AddInt64(&m.stats.writers, 1)
+	m.hookAccessor(WriterAccessor, true)
 
 	return writer, nil
 }
 
+// view is like Reader.view, but reports that the Writer is closed.
+// Lock map before calling.
+func (w *Writer) view() ([]byte, error) {
+	if w.data != nil && w.isClosed() {
+		return nil, errors.New("mmap writer closed").Set("name", w.Name())
+	}
+	return w.Reader.view()
+}
+
 // Poke sets the byte at offset.
 func (w *Writer) Poke(b byte, offset int) error {
 	w.access.RLock()
 	defer w.access.RUnlock()
 
-	if w.closed {
-		return errors.New("mmap writer closed").Set("name", w.name)
-	}
-
-	w.Lock()
+	w.lock()
 	defer w.Unlock()
 
-	if w.data == nil {
-		return errors.New("mmap closed").Set("name", w.name)
+	data, err := w.view()
+	if err != nil {
+		return err
+	}
+
+	if offset < 0 || len(data) <= offset {
+		return errors.New("offset out of range").Set("name", w.Name()).
+			Set("offset", offset).Set("map_size", len(data))
 	}
 
-	if offset < 0 || len(w.data) <= offset {
-		return errors.New("offset out of range").Set("name", w.name).
-			Set("offset", offset).Set("map_size", len(w.data))
+	err = w.checkProtect(w.base+offset, 1, true)
+	if err != nil {
+		return err
 	}
 
-	w.data[offset] = b
+	w.preserve(w.base+offset, 1)
+	data[offset] = b
+	w.stats.addWritten(1)
 
 	if w.wsync {
-		err := msync(w.data, true)
+		err := w.msync(w.data, true)
 		if err != nil {
-			return errors.Wrap(err, "sync error").Set("name", w.name)
+			return errors.Wrap(err, "sync error").Set("name", w.Name())
 		}
 	}
 
@@ -91,18 +157,15 @@ func (w *Writer) Write(b []byte) (n int, err error) {
 	w.access.Lock()
 	defer w.access.Unlock()
 
-	if w.closed {
-		return 0, errors.New("mmap writer closed").Set("name", w.name)
-	}
-
-	w.Lock()
+	w.lock()
 	defer w.Unlock()
 
-	if w.data == nil {
-		return 0, errors.New("mmap closed").Set("name", w.name)
+	data, err := w.view()
+	if err != nil {
+		return 0, err
 	}
 
-	if len(w.data) <= w.offset {
+	if len(data) <= w.offset {
 		return 0, io.EOF
 	}
 
@@ -110,13 +173,21 @@ func (w *Writer) Write(b []byte) (n int, err error) {
 		return 0, nil
 	}
 
-	n = copy(w.data[w.offset:], b)
+	err = w.checkProtect(w.base+w.offset, minInt(len(b), len(data)-w.offset), true)
+	if err != nil {
+		return 0, err
+	}
+
+	w.preserve(w.base+w.offset, len(b))
+	n = copy(data[w.offset:], b)
 	w.offset += n
+	w.stats.addWritten(n)
+	w.unread = 0
 
 	if w.wsync {
-		err := msync(w.data, true)
+		err := w.msync(w.data, true)
 		if err != nil {
-			return 0, errors.Wrap(err, "sync error").Set("name", w.name)
+			return 0, errors.Wrap(err, "sync error").Set("name", w.Name())
 		}
 	}
 
@@ -134,32 +205,36 @@ func (w *Writer) WriteAt(b []byte, offset int64) (n int, err error) {
 	w.access.RLock()
 	defer w.access.RUnlock()
 
-	if w.closed {
-		return 0, errors.New("mmap writer closed").Set("name", w.name)
-	}
-
-	w.Lock()
+	w.lock()
 	defer w.Unlock()
 
-	if w.data == nil {
-		return 0, errors.New("mmap closed").Set("name", w.name)
+	data, err := w.view()
+	if err != nil {
+		return 0, err
 	}
 
 	if len(b) == 0 {
 		return 0, nil
 	}
 
-	if offset < 0 || int64(len(w.data)) <= offset {
-		return 0, errors.New("offset out of range").Set("name", w.name).
-			Set("offset", offset).Set("map_size", len(w.data))
+	if offset < 0 || int64(len(data)) <= offset {
+		return 0, errors.New("offset out of range").Set("name", w.Name()).
+			Set("offset", offset).Set("map_size", len(data))
 	}
 
-	n = copy(w.data[offset:], b)
+	err = w.checkProtect(w.base+int(offset), minInt(len(b), len(data)-int(offset)), true)
+	if err != nil {
+		return 0, err
+	}
+
+	w.preserve(w.base+int(offset), len(b))
+	n = copy(data[offset:], b)
+	w.stats.addWritten(n)
 
 	if w.wsync {
-		err := msync(w.data, true)
+		err := w.msync(w.data, true)
 		if err != nil {
-			return 0, errors.Wrap(err, "sync error").Set("name", w.name)
+			return 0, errors.Wrap(err, "sync error").Set("name", w.Name())
 		}
 	}
 
@@ -175,18 +250,15 @@ func (w *Writer) WriteString(s string) (n int, err error) {
 	w.access.Lock()
 	defer w.access.Unlock()
 
-	if w.closed {
-		return 0, errors.New("mmap writer closed").Set("name", w.name)
-	}
-
-	w.Lock()
+	w.lock()
 	defer w.Unlock()
 
-	if w.data == nil {
-		return 0, errors.New("mmap closed").Set("name", w.name)
+	data, err := w.view()
+	if err != nil {
+		return 0, err
 	}
 
-	if len(w.data) <= w.offset {
+	if len(data) <= w.offset {
 		return 0, io.EOF
 	}
 
@@ -194,13 +266,21 @@ func (w *Writer) WriteString(s string) (n int, err error) {
 		return 0, nil
 	}
 
-	n = copy(w.data[w.offset:], s)
+	err = w.checkProtect(w.base+w.offset, minInt(len(s), len(data)-w.offset), true)
+	if err != nil {
+		return 0, err
+	}
+
+	w.preserve(w.base+w.offset, len(s))
+	n = copy(data[w.offset:], s)
 	w.offset += n
+	w.stats.addWritten(n)
+	w.unread = 0
 
 	if w.wsync {
-		err := msync(w.data, true)
+		err := w.msync(w.data, true)
 		if err != nil {
-			return 0, errors.Wrap(err, "sync error").Set("name", w.name)
+			return 0, errors.Wrap(err, "sync error").Set("name", w.Name())
 		}
 	}
 
@@ -217,30 +297,186 @@ func (w *Writer) WriteByte(b byte) error {
 	w.access.Lock()
 	defer w.access.Unlock()
 
-	if w.closed {
-		return errors.New("mmap writer closed").Set("name", w.name)
-	}
-
-	w.Lock()
+	w.lock()
 	defer w.Unlock()
 
-	if w.data == nil {
-		return errors.New("mmap closed").Set("name", w.name)
+	data, err := w.view()
+	if err != nil {
+		return err
 	}
 
-	if len(w.data) <= w.offset {
+	if len(data) <= w.offset {
 		return io.EOF
 	}
 
-	w.data[w.offset] = b
+	err = w.checkProtect(w.base+w.offset, 1, true)
+	if err != nil {
+		return err
+	}
+
+	w.preserve(w.base+w.offset, 1)
+	data[w.offset] = b
 	w.offset++
+	w.stats.addWritten(1)
+	w.unread = 0
 
 	if w.wsync {
-		err := msync(w.data, true)
+		err := w.msync(w.data, true)
 		if err != nil {
-			return errors.Wrap(err, "sync error").Set("name", w.name)
+			return errors.Wrap(err, "sync error").Set("name", w.Name())
 		}
 	}
 
 	return nil
 }
+
+// ReadFrom reads data from src into the map at the Writer's offset until EOF
+// or an error occurs. It returns the number of bytes read. src reads straight
+// into the mapped bytes, without an intermediate buffer. The map isn't locked
+// while reading from src, so a slow src doesn't hold up other users of the map,
+// but it holds a lease like Borrow on the part src is reading into.
+// If the map fills up, ReadFrom returns io.ErrShortWrite without reading more
+// from src, unless growth was enabled with SetGrow. In that case the map is
+// extended as needed and trimmed to the end of the data when done, but not
+// below the end of any section of another Reader or Writer, and not at all
+// while slices of the map are borrowed.
+func (w *Writer) ReadFrom(src io.Reader) (n int64, err error) {
+	w.access.Lock()
+	defer w.access.Unlock()
+
+	w.unread = 0
+	size := -1
+
+	for {
+		chunk, perr := w.pinFill(&size)
+		if perr != nil {
+			err = perr
+			break
+		}
+
+		c, rerr := src.Read(chunk)
+		w.unpinFill()
+
+		w.offset += c
+		w.stats.addWritten(c)
+		n += int64(c)
+
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			err = rerr
+			break
+		}
+	}
+
+	w.lock()
+	defer w.Unlock()
+
+	if w.data == nil || w.isClosed() {
+		return n, err
+	}
+
+	// Borrowed slices may point into the part that would be trimmed.
+	if size >= 0 && w.leases == 0 {
+		end := w.sectionsEnd()
+		if end < w.offset {
+			end = w.offset
+		}
+		if end < size {
+			end = size
+		}
+
+		if end < len(w.data) {
+			rerr := w.remap(end)
+			if rerr != nil && err == nil {
+				err = errors.Wrap(rerr, "could not trim map after growing").Set("name", w.Name())
+			}
+		}
+	}
+
+	if w.wsync && w.data != nil {
+		serr := w.msync(w.data, true)
+		if serr != nil && err == nil {
+			err = errors.Wrap(serr, "sync error").Set("name", w.Name())
+		}
+	}
+
+	return n, err
+}
+
+// sectionsEnd returns the end of the furthest section of the other Readers and
+// Writers of the map. Lock the map before calling.
+func (w *Writer) sectionsEnd() int {
+	end := 0
+	for _, r := range w.readers {
+		if r.section && end < r.base+r.size {
+			end = r.base + r.size
+		}
+	}
+	for _, o := range w.writers {
+		if o != w && o.section && end < o.base+o.size {
+			end = o.base + o.size
+		}
+	}
+	return end
+}
+
+// pinFill returns the part of the map that ReadFrom reads into next, at most
+// fillChunk bytes from the Writer's offset, and takes a lease that keeps it
+// mapped while the map is unlocked. The map is grown if it is full and allowed
+// to, and its size before it first grows is stored in size. Call unpinFill when
+// done with the part. Lock the Writer's access before calling.
+func (w *Writer) pinFill(size *int) ([]byte, error) {
+	w.lock()
+	defer w.Unlock()
+
+	data, err := w.view()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) <= w.offset {
+		if !w.grow || w.section {
+			return nil, io.ErrShortWrite
+		}
+
+		if *size < 0 {
+			*size = len(w.data)
+		}
+
+		err = w.remap(growSize(len(w.data), w.offset+fillChunk-len(w.data), w.page))
+		if err != nil {
+			return nil, errors.Wrap(err, "could not grow map").Set("name", w.Name())
+		}
+
+		data, err = w.view()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	end := minInt(len(data), w.offset+fillChunk)
+
+	err = w.checkProtect(w.base+w.offset, end-w.offset, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// Snapshots keep the old contents of the part, including snapshots taken
+	// while src is reading into it.
+	w.preserve(w.base+w.offset, end-w.offset)
+	w.fillStart, w.fillEnd = w.base+w.offset, w.base+end
+	w.lease()
+
+	return data[w.offset:end:end], nil
+}
+
+// unpinFill releases the part of the map returned by pinFill.
+func (w *Writer) unpinFill() {
+	w.lock()
+	defer w.Unlock()
+
+	w.fillStart, w.fillEnd = 0, 0
+	w.unlease()
+}
@@ -0,0 +1,181 @@
+package mmap
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReadFrom(t *testing.T) {
+	m, done := tempMap(t, 4)
+	defer done()
+
+	w, _ := m.Writer()
+	src := strings.NewReader("abcdefgh")
+	n, err := w.ReadFrom(src)
+	if n != 4 || err != io.ErrShortWrite {
+		t.Fatalf("ReadFrom returned %d, %v, want 4, %v", n, err, io.ErrShortWrite)
+	}
+
+	rest, _ := ioutil.ReadAll(src)
+	if string(rest) != "efgh" {
+		t.Fatalf("ReadFrom consumed %d bytes past the end of the map", 4-len(rest))
+	}
+
+	m.SetGrow(true)
+	w.Seek(0, SeekStart)
+
+	data := strings.Repeat("x", 200000)
+	n, err = w.ReadFrom(strings.NewReader(data))
+	if n != int64(len(data)) || err != nil {
+		t.Fatalf("ReadFrom returned %d, %v, want %d, nil", n, err, len(data))
+	}
+	if m.Size() != len(data) {
+		t.Fatalf("map grew to %d bytes, want %d", m.Size(), len(data))
+	}
+}
+
+// gateReader reads data once, after being released, and then returns io.EOF.
+type gateReader struct {
+	entered chan struct{}
+	release chan struct{}
+	data    []byte
+}
+
+func (g *gateReader) Read(b []byte) (int, error) {
+	if g.data == nil {
+		return 0, io.EOF
+	}
+
+	g.entered <- struct{}{}
+	<-g.release
+
+	n := copy(b, g.data)
+	g.data = nil
+
+	return n, nil
+}
+
+func TestReadFromLease(t *testing.T) {
+	m, done := tempMap(t, 8)
+	defer done()
+
+	w, _ := m.Writer()
+	w.Write([]byte("old data"))
+	w.Seek(0, SeekStart)
+
+	src := &gateReader{
+		entered: make(chan struct{}),
+		release: make(chan struct{}),
+		data:    []byte("new"),
+	}
+
+	read := make(chan error, 1)
+	go func() {
+		_, err := w.ReadFrom(src)
+		read <- err
+	}()
+
+	<-src.entered
+
+	if err := m.Truncate(16); err == nil {
+		t.Fatal("Truncate succeeded while ReadFrom was reading into the map")
+	}
+
+	s, err := m.SnapshotReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	close(src.release)
+	if err := <-read; err != nil {
+		t.Fatal(err)
+	}
+
+	b := make([]byte, 8)
+	s.ReadAt(b, 0)
+	if string(b) != "old data" {
+		t.Fatalf("snapshot read %q, want %q", b, "old data")
+	}
+
+	r, _ := m.Reader()
+	r.ReadAt(b, 0)
+	if string(b) != "new data" {
+		t.Fatalf("map read %q, want %q", b, "new data")
+	}
+}
+
+func TestReadFromTrim(t *testing.T) {
+	page := os.Getpagesize()
+	m, done := tempMap(t, page, WithGrow())
+	defer done()
+
+	w, _ := m.Writer()
+	src := &gateReader{
+		entered: make(chan struct{}),
+		release: make(chan struct{}),
+		data:    bytes.Repeat([]byte("x"), page),
+	}
+
+	read := make(chan error, 1)
+	go func() {
+		// The map is full, so it grows before src is read.
+		w.Seek(int64(page-1), SeekStart)
+		w.Write([]byte("x"))
+		_, err := w.ReadFrom(src)
+		read <- err
+	}()
+
+	<-src.entered
+
+	size := m.Size()
+	r, err := m.SectionReader(size-100, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	close(src.release)
+	if err := <-read; err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Size() != size {
+		t.Fatalf("map trimmed to %d bytes under a section ending at %d", m.Size(), size)
+	}
+	if _, err := r.ReadAt(make([]byte, 100), 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSectionWriter(t *testing.T) {
+	m, done := tempMap(t, 16)
+	defer done()
+
+	w, err := m.SectionWriter(10, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := w.Write([]byte("abcdefg"))
+	if n != 5 || err != io.ErrShortWrite {
+		t.Fatalf("Write returned %d, %v, want 5, %v", n, err, io.ErrShortWrite)
+	}
+	if _, err := w.WriteAt([]byte("x"), 5); err == nil {
+		t.Fatal("WriteAt past the end of the section succeeded")
+	}
+
+	if pos, err := w.Seek(1, SeekStart); pos != 1 || err != nil {
+		t.Fatalf("Seek returned %d, %v, want 1, nil", pos, err)
+	}
+	w.WriteString("B")
+
+	r, _ := m.Reader()
+	b := make([]byte, 16)
+	r.Read(b)
+	if !bytes.Equal(b, []byte("\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00aBcde\x00")) {
+		t.Fatalf("map contains %q after writing to the section", b)
+	}
+}